@@ -0,0 +1,579 @@
+/*
+Package bitpaytest provides an in-process fake of the Bitpay REST API for
+tests, so they run offline and deterministically.
+
+The fake keeps invoices, refunds, bills, payouts, tokens, sessions and ledgers
+in memory, serves fixed rates and currencies, and checks the signature, token,
+facade and session of every authenticated request like the API does. Tests
+drive what the API would do on its own, such as invoices getting paid, and can
+make calls fail:
+
+	server := bitpaytest.NewServer()
+	defer server.Close()
+
+	token := server.AddToken(clientID, "merchant")
+	bitpay := client.NewClientWithAuth(privateKey, token, server.URL)
+*/
+package bitpaytest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conformal/btcec"
+	"github.com/fundary/bitauth"
+)
+
+// PairingExpiration is how long pairing codes are valid for
+var PairingExpiration = 24 * time.Hour
+
+// facades lists the facades whose tokens can call each authenticated
+// endpoint, endpoints missing from it can be called with any token
+var facades = []struct {
+	method  string
+	parts   []string
+	facades []string
+}{
+	{"POST", []string{"invoices"}, []string{"pos", "merchant"}},
+	{"GET", []string{"invoices", "*"}, []string{"pos", "merchant"}},
+	{"GET", []string{"invoices", "*", "events"}, []string{"pos", "merchant"}},
+	{"*", []string{"invoices"}, []string{"merchant"}},
+	{"*", []string{"invoices", "*", "*"}, []string{"merchant"}},
+	{"*", []string{"invoices", "*", "*", "*"}, []string{"merchant"}},
+	{"*", []string{"bills"}, []string{"merchant"}},
+	{"*", []string{"bills", "*"}, []string{"merchant"}},
+	{"*", []string{"payouts"}, []string{"payroll", "merchant"}},
+	{"*", []string{"payouts", "*"}, []string{"payroll", "merchant"}},
+	{"*", []string{"reports", "payouts"}, []string{"payroll", "merchant"}},
+	{"*", []string{"ledgers"}, []string{"merchant"}},
+	{"*", []string{"ledgers", "*"}, []string{"merchant"}},
+	{"*", []string{"clients"}, []string{"merchant"}},
+	{"*", []string{"clients", "*"}, []string{"merchant"}},
+	{"*", []string{"user"}, []string{"merchant"}},
+}
+
+type (
+	// Resource is a resource held by the fake, as decoded from JSON
+	Resource map[string]interface{}
+
+	// Failure makes the calls matching Method and Path fail with Status and
+	// Message, before they are authenticated
+	Failure struct {
+		// Method matches any method if empty
+		Method string
+
+		// Path is matched with path.Match, e.g. /invoices/*, and matches any
+		// path if empty
+		Path string
+
+		Status  int
+		Message string
+
+		// Times is the number of calls to fail, 0 fails a single call and a
+		// negative number fails all of them
+		Times int
+	}
+
+	// Server is a fake of the Bitpay REST API
+	Server struct {
+		*httptest.Server
+
+		mu       sync.Mutex
+		ids      int
+		tokens   map[string]*token
+		invoices *collection
+		refunds  map[string]*collection
+		bills    *collection
+		payouts  *collection
+		ledgers  map[string][]Resource
+		sessions map[string]int64
+		guids    map[string]Resource
+		user     Resource
+		failures []*Failure
+	}
+
+	token struct {
+		Token             string
+		Facade            string
+		Label             string
+		SIN               string
+		DateCreated       int64
+		PairingCode       string
+		PairingExpiration int64
+		Active            bool
+	}
+
+	collection struct {
+		order []string
+		items map[string]Resource
+	}
+
+	// call is an authenticated request to the fake
+	call struct {
+		method string
+		parts  []string
+		query  url.Values
+		body   Resource
+		token  *token
+		sin    string
+	}
+
+	apiError struct {
+		status  int
+		message string
+	}
+)
+
+// NewServer starts a fake with empty BTC and USD ledgers
+func NewServer() *Server {
+	s := &Server{
+		tokens:   make(map[string]*token),
+		invoices: newCollection(),
+		refunds:  make(map[string]*collection),
+		bills:    newCollection(),
+		payouts:  newCollection(),
+		ledgers:  map[string][]Resource{"BTC": nil, "USD": nil},
+		sessions: make(map[string]int64),
+		guids:    make(map[string]Resource),
+		user:     Resource{"name": "Test Merchant", "phone": "123456789"},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// AddToken issues an active token for a facade to a client ID, as approving
+// a pairing in the dashboard does, and returns it
+func (s *Server) AddToken(clientID, facade string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.newToken(clientID, facade, "")
+	t.Active = true
+
+	return t.Token
+}
+
+// CreatePairingCode creates a pairing code for a facade, as done in the
+// dashboard, for a client ID to claim its token with
+func (s *Server) CreatePairingCode(facade string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.newToken("", facade, "").PairingCode
+}
+
+// ApprovePairing activates the token requested with a pairing code, as
+// approving it in the dashboard does
+func (s *Server) ApprovePairing(pairingCode string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.PairingCode == pairingCode && t.SIN != "" {
+			t.Active = true
+			t.PairingCode = ""
+			t.PairingExpiration = 0
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no token was requested with pairing code %s", pairingCode)
+}
+
+// Fail makes the calls matching f fail
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusInternalServerError
+	}
+	if f.Message == "" {
+		f.Message = http.StatusText(f.Status)
+	}
+	s.failures = append(s.failures, &f)
+}
+
+// ExpireSessions ends all the sessions, calls made in them are then rejected
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]int64)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f := s.failure(r); f != nil {
+		writeError(w, &apiError{f.Status, f.Message})
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, &apiError{http.StatusBadRequest, err.Error()})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	c := &call{method: r.Method, parts: parts, query: r.URL.Query(), body: Resource{}}
+	if len(b) > 0 {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			form, err := url.ParseQuery(string(b))
+			if err != nil {
+				writeError(w, &apiError{http.StatusBadRequest, "Invalid form"})
+				return
+			}
+			for k := range form {
+				c.body[k] = form.Get(k)
+			}
+		} else if err := json.Unmarshal(b, &c.body); err != nil {
+			writeError(w, &apiError{http.StatusBadRequest, "Invalid JSON"})
+			return
+		}
+	}
+
+	var data interface{}
+	var apiErr *apiError
+	switch parts[0] {
+	case "rates":
+		data, apiErr = s.serveRates(c)
+	case "currencies":
+		data, apiErr = s.serveCurrencies(c)
+	case "sessions":
+		data, apiErr = s.serveSessions(c)
+	case "applications":
+		data, apiErr = s.serveApplications(c)
+	case "tokens":
+		if c.method == "POST" {
+			data, apiErr = s.servePairing(c)
+			break
+		}
+		fallthrough
+	default:
+		if apiErr = s.authenticate(r, b, c); apiErr != nil {
+			break
+		}
+
+		switch parts[0] {
+		case "tokens":
+			data, apiErr = s.serveTokens(c)
+		case "invoices":
+			data, apiErr = s.serveInvoices(c)
+		case "bills":
+			data, apiErr = s.serveBills(c)
+		case "payouts", "reports":
+			data, apiErr = s.servePayouts(c)
+		case "ledgers":
+			data, apiErr = s.serveLedgers(c)
+		case "clients":
+			data, apiErr = s.serveClients(c)
+		case "user":
+			data, apiErr = s.serveUser(c)
+		default:
+			apiErr = errNotFound
+		}
+	}
+
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+// authenticate checks the signature of the request, then its token and
+// session when it has them. Only the tokens and sessions endpoints can be
+// called without a token.
+func (s *Server) authenticate(r *http.Request, body []byte, c *call) *apiError {
+	identity := r.Header.Get("X-Identity")
+	signature := r.Header.Get("X-Signature")
+	if identity == "" || signature == "" {
+		return &apiError{http.StatusUnauthorized, "This endpoint requires a signed request"}
+	}
+
+	pub, err := hex.DecodeString(identity)
+	if err != nil {
+		return &apiError{http.StatusUnauthorized, "Invalid identity"}
+	}
+	pubKey, err := btcec.ParsePubKey(pub, btcec.S256())
+	if err != nil {
+		return &apiError{http.StatusUnauthorized, "Invalid identity"}
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return &apiError{http.StatusUnauthorized, "Invalid signature"}
+	}
+	parsed, err := btcec.ParseSignature(sig, btcec.S256())
+	if err != nil {
+		return &apiError{http.StatusUnauthorized, "Invalid signature"}
+	}
+	hash := sha256.Sum256([]byte(s.URL + r.URL.RequestURI() + string(body)))
+	if !parsed.Verify(hash[:], pubKey) {
+		return &apiError{http.StatusUnauthorized, "Invalid signature"}
+	}
+
+	sin, err := bitauth.GetSINFromPublicKeyString(identity)
+	if err != nil {
+		return &apiError{http.StatusUnauthorized, "Invalid identity"}
+	}
+	c.sin = string(sin)
+
+	tokenValue := c.param("token")
+	if tokenValue == "" {
+		if c.parts[0] != "tokens" {
+			return &apiError{http.StatusUnauthorized, "This endpoint requires a token"}
+		}
+	} else {
+		t, ok := s.tokens[tokenValue]
+		if !ok || !t.Active || t.SIN != c.sin {
+			return &apiError{http.StatusUnauthorized, "Invalid token"}
+		}
+		c.token = t
+
+		if !c.allows(t.Facade) {
+			return &apiError{http.StatusForbidden, "This endpoint does not support the " + t.Facade + " facade"}
+		}
+	}
+
+	if id := c.param("sessionId"); id != "" {
+		last, ok := s.sessions[id]
+		if !ok {
+			return &apiError{http.StatusUnauthorized, "Invalid session"}
+		}
+		nonce, err := strconv.ParseInt(c.param("nonce"), 10, 64)
+		if err != nil || nonce <= last {
+			return &apiError{http.StatusUnauthorized, "Invalid nonce"}
+		}
+		s.sessions[id] = nonce
+	}
+
+	return nil
+}
+
+func (s *Server) failure(r *http.Request) *Failure {
+	for i, f := range s.failures {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if f.Path != "" {
+			if ok, _ := path.Match(f.Path, r.URL.Path); !ok {
+				continue
+			}
+		}
+
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+
+		return f
+	}
+
+	return nil
+}
+
+func (s *Server) newID(prefix string) string {
+	s.ids++
+
+	return fmt.Sprintf("%s%06d", prefix, s.ids)
+}
+
+func (s *Server) newToken(sin, facade, label string) *token {
+	if facade == "" {
+		facade = "pos"
+	}
+
+	t := &token{
+		Token:             s.newID("token"),
+		Facade:            facade,
+		Label:             label,
+		SIN:               sin,
+		DateCreated:       millis(time.Now()),
+		PairingCode:       s.newID("pair")[4:],
+		PairingExpiration: millis(time.Now().Add(PairingExpiration)),
+	}
+	s.tokens[t.Token] = t
+
+	return t
+}
+
+// create adds a resource to a collection, unless one was already created
+// with the same guid
+func (s *Server) create(coll *collection, prefix string, r Resource) Resource {
+	guid, _ := r["guid"].(string)
+	if existing, ok := s.guids[guid]; ok && guid != "" {
+		return existing
+	}
+
+	delete(r, "token")
+	delete(r, "guid")
+	delete(r, "sessionId")
+	delete(r, "nonce")
+	r["id"] = s.newID(prefix)
+	coll.add(r)
+	if guid != "" {
+		s.guids[guid] = r
+	}
+
+	return r
+}
+
+// param returns a parameter from the body of POST and PUT calls, or from the
+// query of the others
+func (c *call) param(name string) string {
+	if c.method == "POST" || c.method == "PUT" {
+		switch v := c.body[name].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+
+		return ""
+	}
+
+	return c.query.Get(name)
+}
+
+// route tells whether the call is method on a path, * parts match anything
+func (c *call) route(method string, parts ...string) bool {
+	if c.method != method || len(c.parts) != len(parts) {
+		return false
+	}
+	for i, p := range parts {
+		if p != "*" && p != c.parts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allows returns true if a token of the facade can make the call
+func (c *call) allows(facade string) bool {
+	for _, f := range facades {
+		if !c.route(c.method, f.parts...) || f.method != "*" && f.method != c.method {
+			continue
+		}
+		for _, allowed := range f.facades {
+			if allowed == facade {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func newCollection() *collection {
+	return &collection{items: make(map[string]Resource)}
+}
+
+// copy returns a deep copy of the resource, so it can be handed out without
+// sharing the state of the fake
+func (r Resource) copy() Resource {
+	return copyValue(r).(Resource)
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Resource:
+		c := make(Resource, len(v))
+		for k, value := range v {
+			c[k] = copyValue(value)
+		}
+		return c
+	case map[string]interface{}:
+		return map[string]interface{}(copyValue(Resource(v)).(Resource))
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = copyValue(value)
+		}
+		return c
+	}
+
+	return v
+}
+
+func (c *collection) add(r Resource) {
+	id := r["id"].(string)
+	c.order = append(c.order, id)
+	c.items[id] = r
+}
+
+func (c *collection) get(id string) (Resource, *apiError) {
+	r, ok := c.items[id]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return r, nil
+}
+
+func (c *collection) list() []Resource {
+	list := make([]Resource, 0, len(c.order))
+	for _, id := range c.order {
+		list = append(list, c.items[id])
+	}
+
+	return list
+}
+
+func (c *collection) remove(id string) {
+	delete(c.items, id)
+	for i, o := range c.order {
+		if o == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+var errNotFound = &apiError{http.StatusNotFound, "Object not found"}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.message})
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func sortedKeys(m map[string][]Resource) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
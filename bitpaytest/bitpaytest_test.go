@@ -0,0 +1,164 @@
+package bitpaytest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fundary/bitpay/bitpaytest"
+	"github.com/fundary/bitpay/client"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	privateKey      = "1e99423a4ed27608a15a2616a2b0e9e52ced330ac530edcc32c8ffc6a526aedd"
+	otherPrivateKey = "66670a32b6e14771af941d0be97975369fefe8d4603e0d6816e050c60aa50ca7"
+)
+
+func TestServer(t *testing.T) {
+	Convey("With a fake API", t, func() {
+		server := bitpaytest.NewServer()
+		defer server.Close()
+
+		_, clientID, err := client.DeriveIdentity(privateKey)
+		So(err, ShouldBeNil)
+		token := server.AddToken(clientID, "merchant")
+		bitpay := client.NewClientWithAuth(privateKey, token, server.URL)
+
+		Convey("Calls signed by another key should be rejected", func() {
+			other := client.NewClientWithAuth(otherPrivateKey, token, server.URL)
+			_, _, err := other.QueryInvoices()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Invalid token")
+		})
+
+		Convey("Tampered calls should be rejected", func() {
+			req, err := bitpay.NewRequestWithAuth("GET", server.URL+"/invoices", nil)
+			So(err, ShouldBeNil)
+			req.URL.RawQuery += "&limit=1"
+
+			_, err = bitpay.Send(req, nil)
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Invalid signature")
+		})
+
+		Convey("Calls not allowed to the facade of the token should be rejected", func() {
+			pos := client.NewClientWithAuth(privateKey, server.AddToken(clientID, "pos"), server.URL)
+
+			_, err := pos.CreateInvoice(client.Invoice{Price: 10, Currency: "USD"})
+			So(err, ShouldBeNil)
+			invoices, _, err := bitpay.QueryInvoices()
+			So(err, ShouldBeNil)
+			_, _, err = pos.GetInvoice(invoices[0].ID)
+			So(err, ShouldBeNil)
+
+			_, _, err = pos.QueryInvoices()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "This endpoint does not support the pos facade")
+		})
+
+		Convey("Invoices should be returned as copies", func() {
+			_, err := bitpay.CreateInvoice(client.Invoice{Price: 10, Currency: "USD"})
+			So(err, ShouldBeNil)
+			invoices, _, err := bitpay.QueryInvoices()
+			So(err, ShouldBeNil)
+
+			i, ok := server.Invoice(invoices[0].ID)
+			So(ok, ShouldBeTrue)
+			i["status"] = "complete"
+
+			i, _ = server.Invoice(invoices[0].ID)
+			So(i["status"], ShouldEqual, "new")
+		})
+
+		Convey("Ledger amounts should be rounded to the scale of the currency", func() {
+			_, err := bitpay.CreateInvoice(client.Invoice{Price: 29, Currency: "USD"})
+			So(err, ShouldBeNil)
+			invoices, _, err := bitpay.QueryInvoices()
+			So(err, ShouldBeNil)
+			So(server.SetInvoiceStatus(invoices[0].ID, "confirmed"), ShouldBeNil)
+
+			today := time.Now().UTC()
+			entries, _, err := bitpay.GetLedger("USD", today, today)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(entries[1].Amount, ShouldEqual, -29)
+		})
+
+		Convey("Invoices should go through their lifecycle and credit the ledger", func() {
+			_, err := bitpay.CreateInvoice(client.Invoice{Price: 100, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			invoices, _, err := bitpay.QueryInvoices()
+			So(err, ShouldBeNil)
+			So(invoices, ShouldHaveLength, 1)
+			So(invoices[0].Status, ShouldEqual, client.InvoiceStatusNew)
+
+			for _, status := range []string{"paid", "confirmed"} {
+				next, err := server.AdvanceInvoice(invoices[0].ID)
+				So(err, ShouldBeNil)
+				So(next, ShouldEqual, status)
+			}
+
+			invoice, _, err := bitpay.GetInvoice(invoices[0].ID)
+			So(err, ShouldBeNil)
+			So(invoice.Status, ShouldEqual, client.InvoiceStatusConfirmed)
+
+			today := time.Now().UTC()
+			entries, _, err := bitpay.GetLedger("USD", today, today)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].InvoiceID, ShouldEqual, invoice.ID)
+			So(entries[0].Value(), ShouldEqual, 100)
+			So(entries[1].Category(), ShouldEqual, client.LedgerCategoryFee)
+		})
+
+		Convey("Injected failures should be returned", func() {
+			server.Fail(bitpaytest.Failure{Method: "GET", Path: "/rates/*", Status: http.StatusServiceUnavailable, Message: "Rates are unavailable"})
+
+			_, resp, err := bitpay.GetRateForCurrency("USD")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Rates are unavailable")
+			So(resp.StatusCode, ShouldEqual, http.StatusServiceUnavailable)
+
+			rate, _, err := bitpay.GetRateForCurrency("USD")
+			So(err, ShouldBeNil)
+			So(rate.Code, ShouldEqual, "USD")
+		})
+
+		Convey("Pairing should wait for the approval", func() {
+			pairing := client.NewClientWithAuth(otherPrivateKey, "", server.URL)
+			p, err := pairing.RequestPairing("Shop", client.FacadePOS)
+			So(err, ShouldBeNil)
+
+			So(server.ApprovePairing(p.Token.PairingCode), ShouldBeNil)
+
+			approved, err := pairing.WaitForPairing(context.Background(), p, time.Millisecond)
+			So(err, ShouldBeNil)
+			So(approved.Active(), ShouldBeTrue)
+
+			_, _, err = pairing.QueryInvoices()
+			So(err, ShouldNotBeNil)
+			_, err = pairing.CreateInvoice(client.Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Expired sessions should be renewed", func() {
+			sessions, err := client.New(client.WithBaseURL(server.URL), client.WithPrivateKey(privateKey), client.WithToken(token), client.WithSessions())
+			So(err, ShouldBeNil)
+
+			_, _, err = sessions.QueryInvoices()
+			So(err, ShouldBeNil)
+			first := sessions.Session()
+
+			server.ExpireSessions()
+
+			_, _, err = sessions.QueryInvoices()
+			So(err, ShouldBeNil)
+			So(sessions.Session(), ShouldNotEqual, first)
+		})
+	})
+}
@@ -0,0 +1,401 @@
+package bitpaytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets and personal data in cassettes
+const Redacted = "REDACTED"
+
+var (
+	// ModeRecord sends the calls to the API and records them
+	ModeRecord RecorderMode = "record"
+
+	// ModeReplay answers the calls with recorded responses, calls that weren't
+	// recorded fail
+	ModeReplay RecorderMode = "replay"
+
+	// RedactedHeaders are replaced in recorded requests and responses
+	RedactedHeaders = []string{"X-Signature", "Authorization", "Cookie", "Set-Cookie"}
+
+	// RedactedFields are replaced wherever they appear in recorded bodies and
+	// queries: tokens and buyer contact details
+	RedactedFields = []string{
+		"token", "pairingCode", "buyer", "buyerFields", "notificationEmail", "email",
+	}
+
+	// RedactedFacades are replaced in the {"<facade>": "<token>"} shorthand
+	// listing tokens, objects holding nothing but facade keys
+	RedactedFacades = []string{"public", "pos", "merchant", "payroll"}
+
+	// RedactedContactFields are replaced in contact details, such as bills,
+	// users and the users and organizations of applications: objects holding
+	// an email field or any of them but name, which also names currencies
+	RedactedContactFields = []string{
+		"name", "firstName", "lastName", "phone",
+		"address1", "address2", "city", "state", "zip", "country",
+	}
+
+	// IgnoredFields don't have to match for a call to match a recording, as
+	// they change with every call
+	IgnoredFields = []string{"guid", "nonce", "sessionId", "token"}
+)
+
+type (
+	// RecorderMode tells whether a Recorder records or replays calls
+	RecorderMode string
+
+	// Recorder is an http.RoundTripper recording calls to a cassette file, or
+	// replaying them from it, so tests can run against recordings of the test
+	// API. Plug it into a client with WithHTTPClient.
+	Recorder struct {
+		// Transport sends the calls when recording, http.DefaultTransport if
+		// nil
+		Transport http.RoundTripper
+
+		mode      RecorderMode
+		path      string
+		mu        sync.Mutex
+		cassette  Cassette
+		used      []bool
+		unmatched []string
+	}
+
+	// Cassette holds recorded calls
+	Cassette struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+
+	// Interaction is a recorded call
+	Interaction struct {
+		Request  RecordedRequest  `json:"request"`
+		Response RecordedResponse `json:"response"`
+	}
+
+	// RecordedRequest is the request of a recorded call
+	RecordedRequest struct {
+		Method string      `json:"method"`
+		Path   string      `json:"path"`
+		Query  string      `json:"query,omitempty"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+	}
+
+	// RecordedResponse is the response of a recorded call
+	RecordedResponse struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+	}
+)
+
+// NewRecorder returns a recorder for a cassette file. In replay mode, the
+// cassette is read right away.
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	r := &Recorder{mode: mode, path: path}
+
+	switch mode {
+	case ModeRecord:
+	case ModeReplay:
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &r.cassette); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %s", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("unknown recorder mode %s", mode)
+	}
+
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+
+	return r.record(req, body)
+}
+
+// Save writes the recorded calls to the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r.cassette, "", "	")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, b, 0600)
+}
+
+// Unmatched returns the calls that didn't match any recording in replay mode
+func (r *Recorder) Unmatched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.unmatched...)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Path:   redactPath(req.URL.Path),
+			Query:  redactQuery(req.URL.RawQuery),
+			Header: redactHeader(req.Header),
+			Body:   redactBody(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+			Body:       redactBody(respBody),
+		},
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	query := normalizeQuery(req.URL.RawQuery)
+	normalized := normalizeBody(body)
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.Path != redactPath(req.URL.Path) ||
+			normalizeQuery(in.Request.Query) != query || normalizeBody([]byte(in.Request.Body)) != normalized {
+			continue
+		}
+		r.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header,
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	call := fmt.Sprintf("%s %s?%s %s", req.Method, req.URL.Path, query, normalized)
+	r.unmatched = append(r.unmatched, call)
+
+	return nil, fmt.Errorf("bitpaytest: no recording left in %s matches %s", r.path, call)
+}
+
+func redactHeader(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for k, v := range h {
+		redacted[k] = v
+	}
+	for _, k := range RedactedHeaders {
+		if redacted.Get(k) != "" {
+			redacted.Set(k, Redacted)
+		}
+	}
+
+	return redacted
+}
+
+func redactQuery(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	for _, k := range RedactedFields {
+		if _, ok := values[k]; ok {
+			values.Set(k, Redacted)
+		}
+	}
+
+	return values.Encode()
+}
+
+// redactBody redacts a JSON body, other bodies are recorded as is
+func redactBody(body []byte) string {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return string(body)
+	}
+
+	return string(b)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if tokenShorthand(v) {
+			return redactAll(v)
+		}
+		contact := contactDetails(v)
+
+		for k, field := range v {
+			if contains(RedactedFields, k) || contact && contains(RedactedContactFields, k) {
+				v[k] = redactAll(field)
+			} else {
+				v[k] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactValue(e)
+		}
+	}
+
+	return v
+}
+
+// contactDetails returns true if an object holds contact details
+func contactDetails(v map[string]interface{}) bool {
+	if _, ok := v["email"]; ok {
+		return true
+	}
+	for _, k := range RedactedContactFields {
+		if _, ok := v[k]; ok && k != "name" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactPath redacts the token of the paths of token resources
+func redactPath(p string) string {
+	segments := strings.Split(p, "/")
+	if len(segments) == 3 && segments[1] == "tokens" && segments[2] != "" {
+		segments[2] = Redacted
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// tokenShorthand returns true if an object only holds facade keys, as the
+// {"<facade>": "<token>"} shorthand does
+func tokenShorthand(v map[string]interface{}) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for k := range v {
+		if !contains(RedactedFacades, k) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redactAll replaces the strings of a value, keeping its shape
+func redactAll(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return Redacted
+	case map[string]interface{}:
+		for k, field := range v {
+			v[k] = redactAll(field)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactAll(e)
+		}
+	}
+
+	return v
+}
+
+func normalizeQuery(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	for _, k := range IgnoredFields {
+		values.Del(k)
+	}
+
+	return values.Encode()
+}
+
+// normalizeBody redacts a JSON body and drops its ignored fields, encoding
+// it with sorted keys
+func normalizeBody(body []byte) string {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+
+	v = redactValue(v)
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, k := range IgnoredFields {
+			delete(m, k)
+		}
+	}
+
+	b, _ := json.Marshal(v)
+
+	return string(b)
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+package bitpaytest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fundary/bitpay/bitpaytest"
+	"github.com/fundary/bitpay/client"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecorder(t *testing.T) {
+	Convey("With a cassette recorded against the fake API", t, func() {
+		dir, err := ioutil.TempDir("", "cassette")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "invoices.json")
+
+		server := bitpaytest.NewServer()
+		_, clientID, err := client.DeriveIdentity(privateKey)
+		So(err, ShouldBeNil)
+		token := server.AddToken(clientID, "merchant")
+
+		recorder, err := bitpaytest.NewRecorder(path, bitpaytest.ModeRecord)
+		So(err, ShouldBeNil)
+		bitpay, err := client.New(client.WithBaseURL(server.URL), client.WithPrivateKey(privateKey), client.WithToken(token),
+			client.WithHTTPClient(&http.Client{Transport: recorder}))
+		So(err, ShouldBeNil)
+
+		invoice := client.Invoice{Price: 10, Currency: "USD", Buyer: client.Buyer{Name: "Satoshi", Email: "satoshi@example.com"}}
+		_, err = bitpay.CreateInvoice(invoice)
+		So(err, ShouldBeNil)
+		recorded, _, err := bitpay.QueryInvoices()
+		So(err, ShouldBeNil)
+		So(recorder.Save(), ShouldBeNil)
+		server.Close()
+
+		Convey("Tokens, signatures and buyer details should be redacted", func() {
+			b, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+
+			So(string(b), ShouldNotContainSubstring, token)
+			So(string(b), ShouldNotContainSubstring, "satoshi@example.com")
+			So(string(b), ShouldContainSubstring, bitpaytest.Redacted)
+		})
+
+		Convey("The cassette should only be readable by its owner", func() {
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+		})
+
+		Convey("Replayed calls should get the recorded responses", func() {
+			replayer, err := bitpaytest.NewRecorder(path, bitpaytest.ModeReplay)
+			So(err, ShouldBeNil)
+			replay, err := client.New(client.WithBaseURL(server.URL), client.WithPrivateKey(otherPrivateKey), client.WithToken("other-token"),
+				client.WithHTTPClient(&http.Client{Transport: replayer}), client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+			So(err, ShouldBeNil)
+
+			_, err = replay.CreateInvoice(invoice)
+			So(err, ShouldBeNil)
+			invoices, _, err := replay.QueryInvoices()
+			So(err, ShouldBeNil)
+			So(invoices, ShouldHaveLength, 1)
+			So(invoices[0].ID, ShouldEqual, recorded[0].ID)
+
+			Convey("Calls that weren't recorded should fail", func() {
+				_, _, err := replay.QueryInvoices()
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "no recording left")
+				So(replayer.Unmatched(), ShouldHaveLength, 1)
+				So(strings.HasPrefix(replayer.Unmatched()[0], "GET /invoices"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestRecorderRedaction(t *testing.T) {
+	Convey("With a cassette of calls returning tokens and contact details", t, func() {
+		dir, err := ioutil.TempDir("", "cassette")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "bills.json")
+
+		server := bitpaytest.NewServer()
+		defer server.Close()
+		_, clientID, err := client.DeriveIdentity(privateKey)
+		So(err, ShouldBeNil)
+		token := server.AddToken(clientID, "merchant")
+
+		recorder, err := bitpaytest.NewRecorder(path, bitpaytest.ModeRecord)
+		So(err, ShouldBeNil)
+		bitpay, err := client.New(client.WithBaseURL(server.URL), client.WithPrivateKey(privateKey), client.WithToken(token),
+			client.WithHTTPClient(&http.Client{Transport: recorder}))
+		So(err, ShouldBeNil)
+
+		_, err = bitpay.CreateBill(client.Bill{Currency: "USD", Email: "satoshi@example.com", Phone: "555-0100",
+			Name: "Jane Doe", Address1: "1 Main St", City: "Springfield", Zip: "12345",
+			Items: []client.BillItem{{Description: "Item", Price: 10, Quantity: 1}}})
+		So(err, ShouldBeNil)
+		_, _, err = bitpay.QueryTokens()
+		So(err, ShouldBeNil)
+		_, _, err = bitpay.GetToken(token)
+		So(err, ShouldBeNil)
+		_, _, err = bitpay.GetUser()
+		So(err, ShouldBeNil)
+		_, _, err = bitpay.QueryCurrencies()
+		So(err, ShouldBeNil)
+		So(recorder.Save(), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+
+		Convey("Tokens listed by facade or in paths should be redacted", func() {
+			So(string(b), ShouldNotContainSubstring, token)
+			So(string(b), ShouldContainSubstring, `"path": "/tokens/`+bitpaytest.Redacted+`"`)
+		})
+
+		Convey("Contact details should be redacted", func() {
+			for _, detail := range []string{"555-0100", "Jane Doe", "1 Main St", "Springfield", "12345", "Test Merchant", "123456789"} {
+				So(string(b), ShouldNotContainSubstring, detail)
+			}
+			So(string(b), ShouldContainSubstring, `\"name\":\"US Dollar\"`)
+		})
+
+		Convey("Calls to token paths should be replayed", func() {
+			replayer, err := bitpaytest.NewRecorder(path, bitpaytest.ModeReplay)
+			So(err, ShouldBeNil)
+			replay, err := client.New(client.WithBaseURL(server.URL), client.WithPrivateKey(privateKey), client.WithToken(token),
+				client.WithHTTPClient(&http.Client{Transport: replayer}))
+			So(err, ShouldBeNil)
+
+			_, _, err = replay.GetToken(token)
+			So(err, ShouldBeNil)
+		})
+	})
+}
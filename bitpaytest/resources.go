@@ -0,0 +1,576 @@
+package bitpaytest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// InvoiceLifetime is how long after its creation an invoice expires
+	InvoiceLifetime = 15 * time.Minute
+
+	// FeeRate is the share of the price of an invoice charged as a fee when it
+	// is confirmed
+	FeeRate = 0.01
+
+	// invoiceStates is the lifecycle an invoice goes through when advanced
+	invoiceStates = []string{"new", "paid", "confirmed", "complete"}
+
+	rates = []Resource{
+		{"code": "USD", "name": "US Dollar", "rate": 250.0},
+		{"code": "EUR", "name": "Eurozone Euro", "rate": 230.0},
+		{"code": "GBP", "name": "Pound Sterling", "rate": 165.0},
+		{"code": "BTC", "name": "Bitcoin", "rate": 1.0},
+	}
+
+	currencies = []Resource{
+		{"code": "BTC", "symbol": "฿", "precision": 8, "exchangePctFee": 100, "payoutEnabled": true,
+			"name": "Bitcoin", "plural": "Bitcoin", "alts": "btc", "payoutFields": []string{"bitcoinAddress"}},
+		{"code": "USD", "symbol": "$", "precision": 2, "exchangePctFee": 100, "payoutEnabled": false,
+			"name": "US Dollar", "plural": "US Dollars", "alts": "usd dollar", "payoutFields": []string{}},
+		{"code": "EUR", "symbol": "€", "precision": 2, "exchangePctFee": 100, "payoutEnabled": true,
+			"name": "Eurozone Euro", "plural": "Eurozone Euros", "alts": "eur euro", "payoutFields": []string{"iban", "bic"}},
+	}
+)
+
+// Invoice returns a copy of an invoice held by the fake, changing it doesn't
+// change the invoice
+func (s *Server) Invoice(id string) (Resource, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invoices.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	return i.copy(), true
+}
+
+// AdvanceInvoice moves an invoice to the next state of its lifecycle, from
+// new to paid, confirmed and complete, and returns the new state
+func (s *Server) AdvanceInvoice(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invoices.items[id]
+	if !ok {
+		return "", fmt.Errorf("unknown invoice %s", id)
+	}
+
+	for n, state := range invoiceStates[:len(invoiceStates)-1] {
+		if i["status"] == state {
+			next := invoiceStates[n+1]
+			s.setInvoiceStatus(i, next)
+
+			return next, nil
+		}
+	}
+
+	return "", fmt.Errorf("invoice %s is %s and can't be advanced", id, i["status"])
+}
+
+// SetInvoiceStatus moves an invoice to any state, e.g. expired or invalid
+func (s *Server) SetInvoiceStatus(id, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.invoices.items[id]
+	if !ok {
+		return fmt.Errorf("unknown invoice %s", id)
+	}
+	s.setInvoiceStatus(i, status)
+
+	return nil
+}
+
+// AddLedgerEntry appends an entry to the ledger of a currency. The
+// timestamp is set to now if missing.
+func (s *Server) AddLedgerEntry(currency string, entry Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := entry["timestamp"]; !ok {
+		entry["timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	s.ledgers[currency] = append(s.ledgers[currency], entry)
+}
+
+// setInvoiceStatus changes the status of an invoice, crediting its price and
+// debiting the fee in the ledger of its currency once it is confirmed
+func (s *Server) setInvoiceStatus(i Resource, status string) {
+	previous := i["status"]
+	i["status"] = status
+
+	if status != "confirmed" && status != "complete" || previous == "confirmed" || previous == "complete" {
+		return
+	}
+
+	currency, _ := i["currency"].(string)
+	price, _ := i["price"].(float64)
+	scale := int64(100)
+	if currency == "BTC" {
+		scale = 100000000
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	s.ledgers[currency] = append(s.ledgers[currency],
+		Resource{
+			"code": 1000, "amount": int64(math.Round(price * float64(scale))), "scale": scale, "timestamp": now,
+			"description": "Invoice", "invoiceId": i["id"], "txType": "sale",
+			"invoiceAmount": price, "invoiceCurrency": currency,
+		},
+		Resource{
+			"code": 1023, "amount": -int64(math.Round(price * FeeRate * float64(scale))), "scale": scale, "timestamp": now,
+			"description": "Invoice fee", "invoiceId": i["id"], "txType": "fee",
+		},
+	)
+}
+
+func (s *Server) serveInvoices(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("POST", "invoices"):
+		if _, ok := c.body["price"].(float64); !ok {
+			return nil, &apiError{http.StatusBadRequest, "Price must be a number"}
+		}
+		if _, ok := c.body["currency"].(string); !ok {
+			return nil, &apiError{http.StatusBadRequest, "Invalid currency"}
+		}
+
+		now := time.Now()
+		i := s.create(s.invoices, "inv", c.body)
+		if _, ok := i["status"]; !ok {
+			i["status"] = "new"
+			i["url"] = fmt.Sprintf("%s/invoice?id=%s", s.URL, i["id"])
+			i["invoiceTime"] = millis(now)
+			i["expirationTime"] = millis(now.Add(InvoiceLifetime))
+		}
+
+		return i, nil
+
+	case c.route("GET", "invoices"):
+		return s.invoices.list(), nil
+
+	case c.route("GET", "invoices", "*"):
+		return s.invoices.get(c.parts[1])
+
+	case c.route("GET", "invoices", "*", "events"):
+		if _, err := s.invoices.get(c.parts[1]); err != nil {
+			return nil, err
+		}
+
+		return Resource{
+			"url":     strings.Replace(s.URL, "http", "ws", 1) + "/events",
+			"token":   s.newID("events"),
+			"events":  []string{"payment", "confirmation"},
+			"actions": []string{"subscribe", "unsubscribe"},
+		}, nil
+
+	case c.route("POST", "invoices", "*", "notifications"):
+		if _, err := s.invoices.get(c.parts[1]); err != nil {
+			return nil, err
+		}
+
+		return "Success", nil
+	}
+
+	if len(c.parts) >= 3 && c.parts[2] == "refunds" {
+		return s.serveRefunds(c)
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveRefunds(c *call) (interface{}, *apiError) {
+	i, err := s.invoices.get(c.parts[1])
+	if err != nil {
+		return nil, err
+	}
+	refunds, ok := s.refunds[c.parts[1]]
+	if !ok {
+		refunds = newCollection()
+		s.refunds[c.parts[1]] = refunds
+	}
+
+	switch {
+	case c.route("POST", "invoices", "*", "refunds"):
+		if status := i["status"]; status != "paid" && status != "confirmed" && status != "complete" {
+			return nil, &apiError{http.StatusBadRequest, "Invoice is not refundable"}
+		}
+
+		r := s.create(refunds, "refund", c.body)
+		if _, ok := r["status"]; !ok {
+			r["status"] = "pending"
+			r["requestDate"] = time.Now().UTC().Format(time.RFC3339)
+		}
+
+		return r, nil
+
+	case c.route("GET", "invoices", "*", "refunds"):
+		return refunds.list(), nil
+
+	case c.route("GET", "invoices", "*", "refunds", "*"):
+		return refunds.get(c.parts[3])
+
+	case c.route("DELETE", "invoices", "*", "refunds", "*"):
+		r, err := refunds.get(c.parts[3])
+		if err != nil {
+			return nil, err
+		}
+		if r["status"] != "pending" {
+			return nil, &apiError{http.StatusBadRequest, "Only pending refunds can be cancelled"}
+		}
+		r["status"] = "cancelled"
+
+		return "Success", nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveBills(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("POST", "bills"):
+		b := s.create(s.bills, "bill", c.body)
+		if _, ok := b["status"]; !ok {
+			b["status"] = "draft"
+		}
+
+		return b, nil
+
+	case c.route("GET", "bills"):
+		return s.bills.list(), nil
+
+	case c.route("GET", "bills", "*"):
+		return s.bills.get(c.parts[1])
+
+	case c.route("PUT", "bills", "*"):
+		b, err := s.bills.get(c.parts[1])
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range c.body {
+			if k != "token" && k != "id" && k != "sessionId" && k != "nonce" {
+				b[k] = v
+			}
+		}
+
+		return b, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) servePayouts(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("POST", "payouts"):
+		p := s.create(s.payouts, "payout", c.body)
+		if _, ok := p["status"]; !ok {
+			p["status"] = "new"
+		}
+
+		return p, nil
+
+	case c.route("GET", "payouts"):
+		return s.payouts.list(), nil
+
+	case c.route("PUT", "payouts"):
+		return "Success", nil
+
+	case c.route("GET", "payouts", "*"):
+		return s.payouts.get(c.parts[1])
+
+	case c.route("DELETE", "payouts", "*"):
+		if _, err := s.payouts.get(c.parts[1]); err != nil {
+			return nil, err
+		}
+		s.payouts.remove(c.parts[1])
+
+		return "Success", nil
+
+	case c.route("POST", "reports", "payouts"):
+		return Resource{"status": "queued"}, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveLedgers(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("GET", "ledgers"):
+		var ledgers []Resource
+		for _, currency := range sortedKeys(s.ledgers) {
+			var balance float64
+			for _, e := range s.ledgers[currency] {
+				balance += value(e)
+			}
+			ledgers = append(ledgers, Resource{"currency": currency, "balance": balance})
+		}
+
+		return ledgers, nil
+
+	case c.route("GET", "ledgers", "*"):
+		entries, ok := s.ledgers[c.parts[1]]
+		if !ok {
+			return nil, errNotFound
+		}
+
+		start, err := time.Parse("2006-01-02", c.query.Get("startDate"))
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "Invalid startDate"}
+		}
+		end, err := time.Parse("2006-01-02", c.query.Get("endDate"))
+		if err != nil {
+			return nil, &apiError{http.StatusBadRequest, "Invalid endDate"}
+		}
+		end = end.AddDate(0, 0, 1)
+
+		page := []Resource{}
+		for _, e := range entries {
+			ts, _ := e["timestamp"].(string)
+			t, err := time.Parse(time.RFC3339, ts)
+			if err == nil && !t.Before(start) && t.Before(end) {
+				page = append(page, e)
+			}
+		}
+
+		return page, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveRates(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("GET", "rates"):
+		return rates, nil
+
+	case c.route("GET", "rates", "*"):
+		for _, r := range rates {
+			if r["code"] == c.parts[1] {
+				return r, nil
+			}
+		}
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveCurrencies(c *call) (interface{}, *apiError) {
+	if c.route("GET", "currencies") {
+		return currencies, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveSessions(c *call) (interface{}, *apiError) {
+	if c.route("POST", "sessions") {
+		id := s.newID("session")
+		s.sessions[id] = 0
+
+		return id, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveApplications(c *call) (interface{}, *apiError) {
+	if c.route("POST", "applications") {
+		return Resource{"status": "received"}, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveUser(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("GET", "user"):
+		return s.user, nil
+
+	case c.route("PUT", "user"):
+		// The name of the user is read only
+		if phone, ok := c.body["phone"]; ok {
+			s.user["phone"] = phone
+		}
+
+		return s.user, nil
+	}
+
+	return nil, errNotFound
+}
+
+// servePairing requests a token for a client ID, or claims the token of a
+// pairing code created with CreatePairingCode
+func (s *Server) servePairing(c *call) (interface{}, *apiError) {
+	if !c.route("POST", "tokens") {
+		return nil, errNotFound
+	}
+
+	sin := c.param("id")
+	if sin == "" {
+		return nil, &apiError{http.StatusBadRequest, "A client ID is required"}
+	}
+
+	if code := c.param("pairingCode"); code != "" {
+		for _, t := range s.tokens {
+			if t.PairingCode == code && t.SIN == "" {
+				if time.Now().After(time.Unix(0, t.PairingExpiration*int64(time.Millisecond))) {
+					return nil, &apiError{http.StatusBadRequest, "Pairing code expired"}
+				}
+				t.SIN = sin
+				t.Label = c.param("label")
+				t.Active = true
+				t.PairingCode = ""
+				t.PairingExpiration = 0
+
+				return []Resource{tokenResource(t)}, nil
+			}
+		}
+
+		return nil, &apiError{http.StatusBadRequest, "Invalid pairing code"}
+	}
+
+	t := s.newToken(sin, c.param("facade"), c.param("label"))
+
+	return []Resource{tokenResource(t)}, nil
+}
+
+func (s *Server) serveTokens(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("GET", "tokens"):
+		list := []Resource{}
+		for _, t := range s.clientTokens(c.sin) {
+			list = append(list, Resource{t.Facade: t.Token})
+		}
+
+		return list, nil
+
+	case c.route("GET", "tokens", "*"):
+		t, ok := s.tokens[c.parts[1]]
+		if !ok || t.SIN != c.sin {
+			return nil, errNotFound
+		}
+
+		return tokenResource(t), nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Server) serveClients(c *call) (interface{}, *apiError) {
+	switch {
+	case c.route("GET", "clients"):
+		seen := make(map[string]bool)
+		list := []Resource{}
+		for _, t := range s.sortedTokens() {
+			if t.SIN != "" && !seen[t.SIN] {
+				seen[t.SIN] = true
+				list = append(list, s.clientResource(t.SIN))
+			}
+		}
+
+		return list, nil
+
+	case c.route("GET", "clients", "*"):
+		if len(s.clientTokens(c.parts[1])) == 0 {
+			return nil, errNotFound
+		}
+
+		return s.clientResource(c.parts[1]), nil
+
+	case c.route("DELETE", "clients", "*"):
+		tokens := s.clientTokens(c.parts[1])
+		if len(tokens) == 0 {
+			return nil, errNotFound
+		}
+		for _, t := range tokens {
+			delete(s.tokens, t.Token)
+		}
+
+		return "Success", nil
+	}
+
+	return nil, errNotFound
+}
+
+// clientTokens returns the active tokens of a client ID, oldest first
+func (s *Server) clientTokens(sin string) []*token {
+	var tokens []*token
+	for _, t := range s.sortedTokens() {
+		if t.SIN == sin && t.Active {
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens
+}
+
+func (s *Server) sortedTokens() []*token {
+	values := make([]string, 0, len(s.tokens))
+	for v := range s.tokens {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	tokens := make([]*token, len(values))
+	for i, v := range values {
+		tokens[i] = s.tokens[v]
+	}
+
+	return tokens
+}
+
+func (s *Server) clientResource(sin string) Resource {
+	tokens := s.clientTokens(sin)
+	list := make([]Resource, len(tokens))
+	for i, t := range tokens {
+		list[i] = tokenResource(t)
+	}
+
+	return Resource{"id": sin, "label": tokens[0].Label, "dateCreated": tokens[0].DateCreated, "tokens": list}
+}
+
+func tokenResource(t *token) Resource {
+	r := Resource{
+		"token":       t.Token,
+		"facade":      t.Facade,
+		"label":       t.Label,
+		"dateCreated": t.DateCreated,
+		"policies":    []Resource{{"policy": "id", "method": "require", "params": []string{t.SIN}}},
+	}
+	if !t.Active {
+		r["pairingCode"] = t.PairingCode
+		r["pairingExpiration"] = t.PairingExpiration
+		r["policies"] = []Resource{{"policy": "id", "method": "inactive", "params": []string{t.SIN}}}
+	}
+
+	return r
+}
+
+// value returns the amount of a ledger entry in units of its currency
+func value(e Resource) float64 {
+	amount := number(e["amount"])
+	if scale := number(e["scale"]); scale != 0 {
+		return amount / scale
+	}
+
+	return amount
+}
+
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+
+	return 0
+}
@@ -7,16 +7,18 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
-	"log"
+	"math/big"
 	"net/http"
 	"net/url"
-	"os"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/conformal/btcec"
 	"github.com/fundary/bitauth"
@@ -33,12 +35,10 @@ const (
 )
 
 var (
-	// Debug is a flag to enable/disable debug messages
-	Debug bool
-
 	FacadePublic   Facade = "public"
 	FacadePOS      Facade = "pos"
 	FacadeMerchant Facade = "merchant"
+	FacadePayroll  Facade = "payroll"
 )
 
 type (
@@ -50,11 +50,28 @@ type (
 	// Client represents a Bitpay REST API Client
 	Client struct {
 		client     *http.Client
-		privateKey string
-		publicKey  string
-		sin        string
+		signer     Signer
 		token      string
+		tokens     *facadeTokens
 		apiBase    string
+		userAgent  string
+		apiVersion string
+		logger     Logger
+		retry      RetryPolicy
+		middleware []Middleware
+
+		// serverVersion is the API version reported by the last response
+		serverVersion *atomic.Value
+
+		// ctx is the context of the calls of a client returned by WithContext
+		ctx    context.Context
+		tracer Tracer
+
+		// limiters limit the calls by group of endpoints
+		limiters map[string]*limiter
+
+		// session is set in session mode
+		session *session
 	}
 
 	// Response represents a response from Bitpay API, it contains either an error
@@ -63,58 +80,108 @@ type (
 		Error string          `json:"error"`
 		Data  json.RawMessage `json:"data"`
 	}
-)
 
-func init() {
-	var err error
-	debug := os.Getenv("BITPAY_DEBUG")
-	if debug != "" {
-		Debug, err = strconv.ParseBool(debug)
-		if err != nil {
-			panic("Invalid value for BITPAY_DEBUG")
-		}
+	// authRequest is an authenticated request before it is signed
+	authRequest struct {
+		method string
+		u      *url.URL
+
+		// body is set for methods sending the token in the body, raw holds
+		// the payload of the others
+		body map[string]interface{}
+		raw  []byte
 	}
-}
 
-// NewClient returns a new Client struct without keys and SIN
+	authRequestKey struct{}
+)
+
+// NewClient returns a new Client struct without keys and SIN. Its calls are
+// logged to stderr when BITPAY_DEBUG is set to a true value, until a logger
+// is set with WithLogger.
 func NewClient(APIBase string) *Client {
 	return &Client{
-		client:  &http.Client{},
-		apiBase: APIBase,
+		client:        &http.Client{},
+		logger:        envLogger(),
+		serverVersion: &atomic.Value{},
+		tokens:        &facadeTokens{tokens: make(map[Facade]TokenResp)},
+		apiBase:       APIBase,
+		apiVersion:    DefaultAPIVersion,
 	}
 }
 
-// NewClientWithAuth returns a new client with keys and SIN
+// NewClientWithAuth returns a new client with keys and SIN. It panics if the
+// private key is invalid, use New with WithPrivateKey to get an error instead.
+// The facade of token is unknown, so calls aren't checked against it before
+// being sent until it is loaded with LoadTokens, or given with
+// NewClientWithTokens instead.
 func NewClientWithAuth(privateKey, token, APIBase string) *Client {
-	decoded, err := hex.DecodeString(privateKey)
+	client, err := newClient(APIBase, WithPrivateKey(privateKey), WithToken(token))
 	if err != nil {
 		panic(err)
 	}
 
+	return client
+}
+
+// NewClientWithSigner returns a new client signing its requests with signer,
+// so the private key can be kept outside of the client
+func NewClientWithSigner(signer Signer, token, APIBase string) *Client {
+	client := NewClient(APIBase)
+	client.signer = signer
+	client.token = token
+
+	return client
+}
+
+// DeriveIdentity returns the hex encoded compressed public key and the client
+// ID (SIN) of a hex encoded private key
+func DeriveIdentity(privateKey string) (publicKey, sin string, err error) {
+	decoded, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The scalar must be in [1, N-1] to be a private key of the curve
+	if d := new(big.Int).SetBytes(decoded); d.Sign() == 0 || d.Cmp(btcec.S256().N) >= 0 {
+		return "", "", errors.New("invalid private key")
+	}
+
 	_, pubKey := btcec.PrivKeyFromBytes(btcec.S256(), decoded)
 	if pubKey == nil {
-		panic("Invalid private key")
+		return "", "", errors.New("invalid private key")
 	}
-	publicKey := hex.EncodeToString(pubKey.SerializeCompressed())
+	publicKey = hex.EncodeToString(pubKey.SerializeCompressed())
+
+	id, err := bitauth.GetSINFromPublicKeyString(publicKey)
 	if err != nil {
-		panic(err)
+		return "", "", err
 	}
 
-	sin, err := bitauth.GetSINFromPublicKeyString(publicKey)
+	return publicKey, string(id), nil
+}
+
+// NewClientWithTokens returns a new client with keys, SIN and a token per
+// facade. Each call is authenticated with the token of the facade it requires.
+// It panics if the private key is invalid, like NewClientWithAuth.
+func NewClientWithTokens(privateKey string, tokens TokenSet, APIBase string) *Client {
+	client, err := newClient(APIBase, WithPrivateKey(privateKey), WithTokens(tokens))
 	if err != nil {
 		panic(err)
 	}
-	clientID := string(sin)
-
-	client := NewClient(APIBase)
-	client.privateKey = privateKey
-	client.publicKey = publicKey
-	client.sin = clientID
-	client.token = token
 
 	return client
 }
 
+// ClientID returns the client ID (SIN) derived from the private key of the
+// client, empty if the client has no signer
+func (c *Client) ClientID() string {
+	if c.signer == nil {
+		return ""
+	}
+
+	return c.signer.SIN()
+}
+
 // NewRequest constructs a request. If payload is not empty, it will be
 // marshalled into JSON
 func (c *Client) NewRequest(method, url string, payload interface{}) (*http.Request, error) {
@@ -133,17 +200,29 @@ func (c *Client) NewRequest(method, url string, payload interface{}) (*http.Requ
 // NewRequestWithAuth constructs a request. Will do the following things:
 // 1. If payload is not empty, it will be marshalled into JSON.
 // 2. Applies signing and auth headers.
-// 3. Add token and guid to the body
+// 3. Add token and guid to the body, the token is the one of the facade
+// required by the endpoint
+// In session mode, the request is returned unsigned and without its body,
+// which depend on the session ID and nonce it is sent with. It is signed,
+// and signed again with a new nonce for each retry, when sent by Send.
 func (c *Client) NewRequestWithAuth(method, endpoint string, payload interface{}) (*http.Request, error) {
-	var buf io.Reader
 	var b []byte
 	var err error
 
+	if c.signer == nil {
+		return nil, errors.New("authenticated requests require a client with a signer")
+	}
+
 	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	token, err := c.tokenFor(method, u)
+	if err != nil {
+		return nil, err
+	}
+
 	if payload != nil {
 		b, err = json.Marshal(&payload)
 		if err != nil {
@@ -151,52 +230,106 @@ func (c *Client) NewRequestWithAuth(method, endpoint string, payload interface{}
 		}
 	}
 
+	ar := &authRequest{method: method, u: u}
 	if method == "POST" || method == "PUT" {
 		// Add token as field in request body
-		var intermediate map[string]interface{}
-		err = json.Unmarshal(b, &intermediate)
-		if err != nil {
-			return nil, err
+		ar.body = make(map[string]interface{})
+		if len(b) > 0 {
+			err = json.Unmarshal(b, &ar.body)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		intermediate["token"] = c.token
+		if token != "" {
+			ar.body["token"] = token
+		}
 
 		// If we are creating a new resource, then generate a guid and pass it along
 		if method == "POST" {
-			intermediate["guid"] = uuid.New()
+			ar.body["guid"] = uuid.New()
+		}
+	} else {
+		ar.raw = b
+
+		if token != "" {
+			// Add token as query param
+			if u.RawQuery != "" {
+				u.RawQuery += "&"
+			}
+			u.RawQuery += "token=" + token
+		}
+	}
+
+	if c.session != nil {
+		req, err := http.NewRequest(method, u.String(), nil)
+		if err != nil {
+			return nil, err
 		}
 
-		b, err = json.Marshal(&intermediate)
+		return req.WithContext(context.WithValue(req.Context(), authRequestKey{}, ar)), nil
+	}
+
+	return c.sign(ar, "", 0)
+}
+
+// sign returns the signed request of ar, with the session ID and nonce if a
+// session is given
+func (c *Client) sign(ar *authRequest, session Session, nonce int64) (*http.Request, error) {
+	var buf io.Reader
+	b := ar.raw
+	u := *ar.u
+
+	if ar.body != nil {
+		body := make(map[string]interface{}, len(ar.body)+2)
+		for k, v := range ar.body {
+			body[k] = v
+		}
+		if session != "" {
+			body["sessionId"] = session
+			body["nonce"] = nonce
+		}
+
+		var err error
+		b, err = json.Marshal(&body)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		// Add token as query param
+	} else if session != "" {
 		if u.RawQuery != "" {
 			u.RawQuery += "&"
 		}
-		u.RawQuery += "token=" + c.token
+		u.RawQuery += "sessionId=" + url.QueryEscape(string(session)) + "&nonce=" + strconv.FormatInt(nonce, 10)
 	}
 
 	if len(b) > 0 {
 		buf = bytes.NewBuffer(b)
 	}
 
-	req, err := http.NewRequest(method, u.String(), buf)
+	req, err := http.NewRequest(ar.method, u.String(), buf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Sign the request
-	signed, err := bitauth.Sign(u.String()+string(b), c.privateKey)
+	signed, err := c.signer.Sign(u.String() + string(b))
+	if err != nil {
+		return nil, err
+	}
 
-	req.Header.Set("X-Identity", c.publicKey)
+	req.Header.Set("X-Identity", c.signer.PublicKey())
 	req.Header.Set("X-Signature", signed)
 
-	return req, err
+	return req, nil
 }
 
 // Send makes a request to the API, the response body will be
 // unmarshaled into v, or if v is an io.Writer, the response will
 // be written to it without decoding
 func (c *Client) Send(req *http.Request, v interface{}) (*http.Response, error) {
+	req, cancel := c.withContext(req)
+	defer cancel()
+
 	// Set default headers
 	req.Header.Set("Accept", "application/json")
 
@@ -206,30 +339,23 @@ func (c *Client) Send(req *http.Request, v interface{}) (*http.Response, error)
 	}
 
 	if req.Header.Get("X-Accept-Version") == "" {
-		req.Header.Set("X-Accept-Version", "2.0.0")
-	}
-
-	if Debug {
-		log.Println(req.Method, ":", req.URL)
-		log.Println(req.Header)
-		log.Println("Request body:", req.Body)
+		req.Header.Set("X-Accept-Version", c.apiVersion)
 	}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return resp, err
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
 	}
-	defer resp.Body.Close()
 
-	data, err := ioutil.ReadAll(resp.Body)
+	resp, data, err := c.send(req)
 	if err != nil {
 		return resp, err
 	}
 
-	if Debug {
-		log.Println(resp.Status)
-		log.Println(resp.Header)
-		log.Println("Response body:", string(data))
+	version := ResponseAPIVersion(resp)
+	if version != "" {
+		c.serverVersion.Store(version)
+	} else {
+		version = req.Header.Get("X-Accept-Version")
 	}
 
 	r := Response{}
@@ -248,9 +374,9 @@ func (c *Client) Send(req *http.Request, v interface{}) (*http.Response, error)
 
 	if v != nil {
 		if w, ok := v.(io.Writer); ok {
-			io.Copy(w, resp.Body)
+			w.Write(data)
 		} else {
-			err = json.Unmarshal(r.Data, v)
+			err = decodeVersion(version, r.Data, v)
 			if err != nil {
 				return resp, err
 			}
@@ -259,3 +385,91 @@ func (c *Client) Send(req *http.Request, v interface{}) (*http.Response, error)
 
 	return resp, nil
 }
+
+// roundTrip sends the request, logging it and its response
+func (c *Client) roundTrip(req *http.Request) (*http.Response, []byte, error) {
+	start := time.Now()
+	sent, resp, data, err := c.dispatch(req)
+	c.logCall(sent, resp, data, err, time.Since(start))
+
+	return resp, data, err
+}
+
+// dispatch sends the request in the session of the client if the request
+// was created for one. It returns the request last sent, as signed in
+// session mode.
+func (c *Client) dispatch(req *http.Request) (*http.Request, *http.Response, []byte, error) {
+	ar, ok := req.Context().Value(authRequestKey{}).(*authRequest)
+	if !ok || c.session == nil {
+		resp, data, err := c.do(req)
+		return req, resp, data, err
+	}
+
+	return c.session.roundTrip(c, req, ar)
+}
+
+// do sends the request and reads the response body, retrying as told by the
+// retry policy of the client, and waiting for the rate limits of the client
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	return c.attempt(req, func() (*http.Request, error) {
+		if req.Body == nil {
+			return req, nil
+		}
+		if req.GetBody == nil {
+			return nil, errors.New("the request body can't be sent again")
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+
+		return req, nil
+	})
+}
+
+// attempt sends req, then the request returned by retry for each retry. The
+// call isn't retried if retry fails.
+func (c *Client) attempt(req *http.Request, retry func() (*http.Request, error)) (*http.Response, []byte, error) {
+	limiter := c.limiter(req)
+
+	for attempt := 1; ; attempt++ {
+		if limiter != nil {
+			if err := limiter.acquire(req.Context()); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		attemptReq, span := c.startAttempt(req, attempt)
+		resp, err := c.client.Do(attemptReq)
+
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		endAttempt(span, resp, err)
+		if limiter != nil {
+			limiter.done(resp)
+		}
+
+		if !c.retry.retryable(attempt, resp, err) {
+			return resp, data, err
+		}
+		next, retryErr := retry()
+		if retryErr != nil {
+			return resp, data, err
+		}
+
+		wait := c.retry.wait(attempt, resp)
+		c.log(LevelWarn, "retrying call", Field{"method", req.Method}, Field{"endpoint", c.endpoint(req)},
+			Field{"attempt", attempt}, Field{"wait", wait})
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return resp, data, req.Context().Err()
+		}
+		req = next
+	}
+}
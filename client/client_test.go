@@ -1,6 +1,10 @@
 package client
 
-import "os"
+import (
+	"os"
+
+	"github.com/fundary/bitpay/bitpaytest"
+)
 
 var testClient *Client
 var done = make(chan bool)
@@ -9,23 +13,30 @@ func init() {
 	getTestClient()
 }
 
+// getTestClient returns a client for the test API when BITPAY_PRIVATE_KEY
+// and BITPAY_TOKEN are set, or for an in-process fake of the API otherwise
 func getTestClient() *Client {
 	if testClient == nil {
-
+		apiBase := APIBaseTest
 		privateKey := os.Getenv("BITPAY_PRIVATE_KEY")
-		if privateKey == "" {
-			panic("Bitpay test private key is missing")
-		}
-
 		token := os.Getenv("BITPAY_TOKEN")
-		if token == "" {
-			panic("Bitpay test token is missing")
+
+		if privateKey == "" || token == "" {
+			server := bitpaytest.NewServer()
+			_, clientID, err := DeriveIdentity(testPrivateKey)
+			if err != nil {
+				panic(err)
+			}
+
+			apiBase = server.URL
+			privateKey = testPrivateKey
+			token = server.AddToken(clientID, string(FacadeMerchant))
 		}
 
 		testClient = NewClientWithAuth(
 			privateKey,
 			token,
-			APIBaseTest,
+			apiBase,
 		)
 
 		close(done)
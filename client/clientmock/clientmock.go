@@ -0,0 +1,138 @@
+// Package clientmock provides in-memory mocks of the services of the client
+// package. Each mock records its calls and returns the results of the Func
+// field named after the method, or an error when that field isn't set:
+//
+//	invoices := &clientmock.InvoiceService{
+//		GetInvoiceFunc: func(ID string) (*client.Invoice, *http.Response, error) {
+//			return &client.Invoice{ID: ID, Status: client.InvoiceStatusPaid}, nil, nil
+//		},
+//	}
+//	...
+//	calls := invoices.CallsTo("GetInvoice")
+package clientmock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fundary/bitpay/client"
+)
+
+var _ client.API = (*Client)(nil)
+
+// sequence orders the calls recorded by different mocks
+var sequence uint64
+
+type (
+	// Call is a call recorded by a mock
+	Call struct {
+		Method string
+		Args   []interface{}
+
+		seq uint64
+	}
+
+	// Recorder records the calls made to a mock
+	Recorder struct {
+		mu    sync.Mutex
+		calls []Call
+	}
+
+	// Client is a mock of client.API, made of the mocks of every service
+	Client struct {
+		ApplicationService
+		BillService
+		ClientService
+		CurrencyService
+		InvoiceService
+		LedgerService
+		PairingService
+		PayoutService
+		RateService
+		TokenService
+		UserService
+	}
+)
+
+// Calls returns the recorded calls, in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the recorded calls of a method, in order
+func (r *Recorder) CallsTo(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []Call
+	for _, call := range r.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, Call{Method: method, Args: args, seq: atomic.AddUint64(&sequence, 1)})
+}
+
+// Calls returns the calls recorded by all the services, in order
+func (c *Client) Calls() []Call {
+	var calls []Call
+	for _, r := range c.recorders() {
+		calls = append(calls, r.Calls()...)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].seq < calls[j].seq })
+
+	return calls
+}
+
+// CallsTo returns the recorded calls of a method, in order
+func (c *Client) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range c.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the calls recorded by all the services
+func (c *Client) Reset() {
+	for _, r := range c.recorders() {
+		r.Reset()
+	}
+}
+
+func (c *Client) recorders() []*Recorder {
+	return []*Recorder{
+		&c.ApplicationService.Recorder, &c.BillService.Recorder, &c.ClientService.Recorder,
+		&c.CurrencyService.Recorder, &c.InvoiceService.Recorder, &c.LedgerService.Recorder,
+		&c.PairingService.Recorder, &c.PayoutService.Recorder, &c.RateService.Recorder,
+		&c.TokenService.Recorder, &c.UserService.Recorder,
+	}
+}
+
+func notSet(method string) error {
+	return fmt.Errorf("clientmock: %sFunc is not set", method)
+}
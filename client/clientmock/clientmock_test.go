@@ -0,0 +1,52 @@
+package clientmock
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fundary/bitpay/client"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient(t *testing.T) {
+	Convey("With a mock client", t, func() {
+		mock := &Client{}
+		var api client.API = mock
+
+		Convey("Calls should return the results of the Func fields", func() {
+			mock.GetInvoiceFunc = func(ID string) (*client.Invoice, *http.Response, error) {
+				return &client.Invoice{ID: ID, Status: client.InvoiceStatusPaid}, nil, nil
+			}
+
+			invoice, _, err := api.GetInvoice("invoice-id")
+
+			So(err, ShouldBeNil)
+			So(invoice.ID, ShouldEqual, "invoice-id")
+			So(invoice.Status, ShouldEqual, client.InvoiceStatusPaid)
+		})
+
+		Convey("Calls without a Func field should fail", func() {
+			_, _, err := api.GetPayout("payout-id")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "clientmock: PayoutService.GetPayoutFunc is not set")
+		})
+
+		Convey("Calls should be recorded in order across services", func() {
+			api.QueryRates()
+			api.CreateInvoice(client.Invoice{Price: 1, Currency: "USD"})
+			api.GetRateForCurrency("EUR")
+
+			calls := mock.Calls()
+			So(calls, ShouldHaveLength, 3)
+			So(calls[0].Method, ShouldEqual, "QueryRates")
+			So(calls[1].Method, ShouldEqual, "CreateInvoice")
+			So(calls[1].Args, ShouldResemble, []interface{}{client.Invoice{Price: 1, Currency: "USD"}})
+			So(mock.RateService.Calls(), ShouldHaveLength, 2)
+			So(mock.CallsTo("GetRateForCurrency")[0].Args, ShouldResemble, []interface{}{"EUR"})
+
+			mock.Reset()
+			So(mock.Calls(), ShouldBeEmpty)
+		})
+	})
+}
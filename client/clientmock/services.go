@@ -0,0 +1,507 @@
+package clientmock
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fundary/bitpay/client"
+)
+
+var (
+	_ client.ApplicationService = (*ApplicationService)(nil)
+	_ client.BillService        = (*BillService)(nil)
+	_ client.ClientService      = (*ClientService)(nil)
+	_ client.CurrencyService    = (*CurrencyService)(nil)
+	_ client.InvoiceService     = (*InvoiceService)(nil)
+	_ client.LedgerService      = (*LedgerService)(nil)
+	_ client.PairingService     = (*PairingService)(nil)
+	_ client.PayoutService      = (*PayoutService)(nil)
+	_ client.RateService        = (*RateService)(nil)
+	_ client.TokenService       = (*TokenService)(nil)
+	_ client.UserService        = (*UserService)(nil)
+)
+
+// ApplicationService is a mock of client.ApplicationService
+type ApplicationService struct {
+	Recorder
+
+	CreateApplicationFunc func(a client.Application) (*http.Response, error)
+}
+
+// CreateApplication records the call and returns the results of CreateApplicationFunc
+func (m *ApplicationService) CreateApplication(a client.Application) (*http.Response, error) {
+	m.record("CreateApplication", a)
+	if m.CreateApplicationFunc == nil {
+		return nil, notSet("ApplicationService.CreateApplication")
+	}
+
+	return m.CreateApplicationFunc(a)
+}
+
+// BillService is a mock of client.BillService
+type BillService struct {
+	Recorder
+
+	CreateBillFunc func(b client.Bill) (*http.Response, error)
+	QueryBillsFunc func() ([]client.Bill, *http.Response, error)
+	GetBillFunc    func(ID string) (*client.Bill, *http.Response, error)
+	UpdateBillFunc func(b client.Bill) (*http.Response, error)
+}
+
+// CreateBill records the call and returns the results of CreateBillFunc
+func (m *BillService) CreateBill(b client.Bill) (*http.Response, error) {
+	m.record("CreateBill", b)
+	if m.CreateBillFunc == nil {
+		return nil, notSet("BillService.CreateBill")
+	}
+
+	return m.CreateBillFunc(b)
+}
+
+// QueryBills records the call and returns the results of QueryBillsFunc
+func (m *BillService) QueryBills() ([]client.Bill, *http.Response, error) {
+	m.record("QueryBills")
+	if m.QueryBillsFunc == nil {
+		return nil, nil, notSet("BillService.QueryBills")
+	}
+
+	return m.QueryBillsFunc()
+}
+
+// GetBill records the call and returns the results of GetBillFunc
+func (m *BillService) GetBill(ID string) (*client.Bill, *http.Response, error) {
+	m.record("GetBill", ID)
+	if m.GetBillFunc == nil {
+		return nil, nil, notSet("BillService.GetBill")
+	}
+
+	return m.GetBillFunc(ID)
+}
+
+// UpdateBill records the call and returns the results of UpdateBillFunc
+func (m *BillService) UpdateBill(b client.Bill) (*http.Response, error) {
+	m.record("UpdateBill", b)
+	if m.UpdateBillFunc == nil {
+		return nil, notSet("BillService.UpdateBill")
+	}
+
+	return m.UpdateBillFunc(b)
+}
+
+// ClientService is a mock of client.ClientService
+type ClientService struct {
+	Recorder
+
+	QueryClientsFunc func() ([]client.BitpayClient, *http.Response, error)
+	GetClientFunc    func(clientID string) (*client.BitpayClient, *http.Response, error)
+	DeleteClientFunc func(clientID string) (*http.Response, error)
+}
+
+// QueryClients records the call and returns the results of QueryClientsFunc
+func (m *ClientService) QueryClients() ([]client.BitpayClient, *http.Response, error) {
+	m.record("QueryClients")
+	if m.QueryClientsFunc == nil {
+		return nil, nil, notSet("ClientService.QueryClients")
+	}
+
+	return m.QueryClientsFunc()
+}
+
+// GetClient records the call and returns the results of GetClientFunc
+func (m *ClientService) GetClient(clientID string) (*client.BitpayClient, *http.Response, error) {
+	m.record("GetClient", clientID)
+	if m.GetClientFunc == nil {
+		return nil, nil, notSet("ClientService.GetClient")
+	}
+
+	return m.GetClientFunc(clientID)
+}
+
+// DeleteClient records the call and returns the results of DeleteClientFunc
+func (m *ClientService) DeleteClient(clientID string) (*http.Response, error) {
+	m.record("DeleteClient", clientID)
+	if m.DeleteClientFunc == nil {
+		return nil, notSet("ClientService.DeleteClient")
+	}
+
+	return m.DeleteClientFunc(clientID)
+}
+
+// CurrencyService is a mock of client.CurrencyService
+type CurrencyService struct {
+	Recorder
+
+	QueryCurrenciesFunc func() ([]client.Currency, *http.Response, error)
+}
+
+// QueryCurrencies records the call and returns the results of QueryCurrenciesFunc
+func (m *CurrencyService) QueryCurrencies() ([]client.Currency, *http.Response, error) {
+	m.record("QueryCurrencies")
+	if m.QueryCurrenciesFunc == nil {
+		return nil, nil, notSet("CurrencyService.QueryCurrencies")
+	}
+
+	return m.QueryCurrenciesFunc()
+}
+
+// InvoiceService is a mock of client.InvoiceService
+type InvoiceService struct {
+	Recorder
+
+	CreateInvoiceFunc             func(i client.Invoice) (*http.Response, error)
+	QueryInvoicesFunc             func() ([]client.Invoice, *http.Response, error)
+	GetInvoiceFunc                func(ID string) (*client.Invoice, *http.Response, error)
+	GetInvoiceEventsFunc          func(ID string) (*client.EventResp, *http.Response, error)
+	CreateInvoiceRefundFunc       func(invoiceID string, r client.InvoiceRefund) (*http.Response, error)
+	DeleteInvoiceRefundFunc       func(invoiceID string, refundID string) (*http.Response, error)
+	AcceptInvoiceAdjustmentFunc   func(invoiceID string, adjustment client.InvoiceAdjustment) (*http.Response, error)
+	CreateInvoiceNotificationFunc func(invoiceID string) (*http.Response, error)
+}
+
+// CreateInvoice records the call and returns the results of CreateInvoiceFunc
+func (m *InvoiceService) CreateInvoice(i client.Invoice) (*http.Response, error) {
+	m.record("CreateInvoice", i)
+	if m.CreateInvoiceFunc == nil {
+		return nil, notSet("InvoiceService.CreateInvoice")
+	}
+
+	return m.CreateInvoiceFunc(i)
+}
+
+// QueryInvoices records the call and returns the results of QueryInvoicesFunc
+func (m *InvoiceService) QueryInvoices() ([]client.Invoice, *http.Response, error) {
+	m.record("QueryInvoices")
+	if m.QueryInvoicesFunc == nil {
+		return nil, nil, notSet("InvoiceService.QueryInvoices")
+	}
+
+	return m.QueryInvoicesFunc()
+}
+
+// GetInvoice records the call and returns the results of GetInvoiceFunc
+func (m *InvoiceService) GetInvoice(ID string) (*client.Invoice, *http.Response, error) {
+	m.record("GetInvoice", ID)
+	if m.GetInvoiceFunc == nil {
+		return nil, nil, notSet("InvoiceService.GetInvoice")
+	}
+
+	return m.GetInvoiceFunc(ID)
+}
+
+// GetInvoiceEvents records the call and returns the results of GetInvoiceEventsFunc
+func (m *InvoiceService) GetInvoiceEvents(ID string) (*client.EventResp, *http.Response, error) {
+	m.record("GetInvoiceEvents", ID)
+	if m.GetInvoiceEventsFunc == nil {
+		return nil, nil, notSet("InvoiceService.GetInvoiceEvents")
+	}
+
+	return m.GetInvoiceEventsFunc(ID)
+}
+
+// CreateInvoiceRefund records the call and returns the results of CreateInvoiceRefundFunc
+func (m *InvoiceService) CreateInvoiceRefund(invoiceID string, r client.InvoiceRefund) (*http.Response, error) {
+	m.record("CreateInvoiceRefund", invoiceID, r)
+	if m.CreateInvoiceRefundFunc == nil {
+		return nil, notSet("InvoiceService.CreateInvoiceRefund")
+	}
+
+	return m.CreateInvoiceRefundFunc(invoiceID, r)
+}
+
+// DeleteInvoiceRefund records the call and returns the results of DeleteInvoiceRefundFunc
+func (m *InvoiceService) DeleteInvoiceRefund(invoiceID string, refundID string) (*http.Response, error) {
+	m.record("DeleteInvoiceRefund", invoiceID, refundID)
+	if m.DeleteInvoiceRefundFunc == nil {
+		return nil, notSet("InvoiceService.DeleteInvoiceRefund")
+	}
+
+	return m.DeleteInvoiceRefundFunc(invoiceID, refundID)
+}
+
+// AcceptInvoiceAdjustment records the call and returns the results of AcceptInvoiceAdjustmentFunc
+func (m *InvoiceService) AcceptInvoiceAdjustment(invoiceID string, adjustment client.InvoiceAdjustment) (*http.Response, error) {
+	m.record("AcceptInvoiceAdjustment", invoiceID, adjustment)
+	if m.AcceptInvoiceAdjustmentFunc == nil {
+		return nil, notSet("InvoiceService.AcceptInvoiceAdjustment")
+	}
+
+	return m.AcceptInvoiceAdjustmentFunc(invoiceID, adjustment)
+}
+
+// CreateInvoiceNotification records the call and returns the results of CreateInvoiceNotificationFunc
+func (m *InvoiceService) CreateInvoiceNotification(invoiceID string) (*http.Response, error) {
+	m.record("CreateInvoiceNotification", invoiceID)
+	if m.CreateInvoiceNotificationFunc == nil {
+		return nil, notSet("InvoiceService.CreateInvoiceNotification")
+	}
+
+	return m.CreateInvoiceNotificationFunc(invoiceID)
+}
+
+// LedgerService is a mock of client.LedgerService
+type LedgerService struct {
+	Recorder
+
+	QueryLedgersFunc        func() ([]client.Ledger, *http.Response, error)
+	GetLedgerFunc           func(currency string, startDate time.Time, endDate time.Time) ([]client.LedgerEntry, *http.Response, error)
+	LoadLedgerAnalyticsFunc func(since time.Time, currencies ...string) (*client.LedgerAnalytics, error)
+	ReconcileLedgerFunc     func(currency string, startDate time.Time, endDate time.Time, opts client.ReconcileOptions) (*client.ReconciliationReport, error)
+}
+
+// QueryLedgers records the call and returns the results of QueryLedgersFunc
+func (m *LedgerService) QueryLedgers() ([]client.Ledger, *http.Response, error) {
+	m.record("QueryLedgers")
+	if m.QueryLedgersFunc == nil {
+		return nil, nil, notSet("LedgerService.QueryLedgers")
+	}
+
+	return m.QueryLedgersFunc()
+}
+
+// GetLedger records the call and returns the results of GetLedgerFunc
+func (m *LedgerService) GetLedger(currency string, startDate time.Time, endDate time.Time) ([]client.LedgerEntry, *http.Response, error) {
+	m.record("GetLedger", currency, startDate, endDate)
+	if m.GetLedgerFunc == nil {
+		return nil, nil, notSet("LedgerService.GetLedger")
+	}
+
+	return m.GetLedgerFunc(currency, startDate, endDate)
+}
+
+// LoadLedgerAnalytics records the call and returns the results of LoadLedgerAnalyticsFunc
+func (m *LedgerService) LoadLedgerAnalytics(since time.Time, currencies ...string) (*client.LedgerAnalytics, error) {
+	m.record("LoadLedgerAnalytics", since, currencies)
+	if m.LoadLedgerAnalyticsFunc == nil {
+		return nil, notSet("LedgerService.LoadLedgerAnalytics")
+	}
+
+	return m.LoadLedgerAnalyticsFunc(since, currencies...)
+}
+
+// ReconcileLedger records the call and returns the results of ReconcileLedgerFunc
+func (m *LedgerService) ReconcileLedger(currency string, startDate time.Time, endDate time.Time, opts client.ReconcileOptions) (*client.ReconciliationReport, error) {
+	m.record("ReconcileLedger", currency, startDate, endDate, opts)
+	if m.ReconcileLedgerFunc == nil {
+		return nil, notSet("LedgerService.ReconcileLedger")
+	}
+
+	return m.ReconcileLedgerFunc(currency, startDate, endDate, opts)
+}
+
+// PairingService is a mock of client.PairingService
+type PairingService struct {
+	Recorder
+
+	PairFunc           func(label string, facade client.Facade, opts client.PairingOptions) (client.TokenResp, error)
+	RequestPairingFunc func(label string, facade client.Facade) (*client.Pairing, error)
+	WaitForPairingFunc func(ctx context.Context, p *client.Pairing, interval time.Duration) (client.TokenResp, error)
+}
+
+// Pair records the call and returns the results of PairFunc
+func (m *PairingService) Pair(label string, facade client.Facade, opts client.PairingOptions) (client.TokenResp, error) {
+	m.record("Pair", label, facade, opts)
+	if m.PairFunc == nil {
+		return client.TokenResp{}, notSet("PairingService.Pair")
+	}
+
+	return m.PairFunc(label, facade, opts)
+}
+
+// RequestPairing records the call and returns the results of RequestPairingFunc
+func (m *PairingService) RequestPairing(label string, facade client.Facade) (*client.Pairing, error) {
+	m.record("RequestPairing", label, facade)
+	if m.RequestPairingFunc == nil {
+		return nil, notSet("PairingService.RequestPairing")
+	}
+
+	return m.RequestPairingFunc(label, facade)
+}
+
+// WaitForPairing records the call and returns the results of WaitForPairingFunc
+func (m *PairingService) WaitForPairing(ctx context.Context, p *client.Pairing, interval time.Duration) (client.TokenResp, error) {
+	m.record("WaitForPairing", ctx, p, interval)
+	if m.WaitForPairingFunc == nil {
+		return client.TokenResp{}, notSet("PairingService.WaitForPairing")
+	}
+
+	return m.WaitForPairingFunc(ctx, p, interval)
+}
+
+// PayoutService is a mock of client.PayoutService
+type PayoutService struct {
+	Recorder
+
+	CreatePayoutFunc         func(p client.Payout) (*http.Response, error)
+	QueryPayoutsFunc         func() ([]client.Payout, *http.Response, error)
+	GetPayoutFunc            func(ID string) (*client.Payout, *http.Response, error)
+	UpdatePayoutFunc         func(p client.Payout) (*http.Response, error)
+	DeletePayoutFunc         func(payoutID string) (*http.Response, error)
+	CreatePayoutsReportsFunc func() (*http.Response, error)
+}
+
+// CreatePayout records the call and returns the results of CreatePayoutFunc
+func (m *PayoutService) CreatePayout(p client.Payout) (*http.Response, error) {
+	m.record("CreatePayout", p)
+	if m.CreatePayoutFunc == nil {
+		return nil, notSet("PayoutService.CreatePayout")
+	}
+
+	return m.CreatePayoutFunc(p)
+}
+
+// QueryPayouts records the call and returns the results of QueryPayoutsFunc
+func (m *PayoutService) QueryPayouts() ([]client.Payout, *http.Response, error) {
+	m.record("QueryPayouts")
+	if m.QueryPayoutsFunc == nil {
+		return nil, nil, notSet("PayoutService.QueryPayouts")
+	}
+
+	return m.QueryPayoutsFunc()
+}
+
+// GetPayout records the call and returns the results of GetPayoutFunc
+func (m *PayoutService) GetPayout(ID string) (*client.Payout, *http.Response, error) {
+	m.record("GetPayout", ID)
+	if m.GetPayoutFunc == nil {
+		return nil, nil, notSet("PayoutService.GetPayout")
+	}
+
+	return m.GetPayoutFunc(ID)
+}
+
+// UpdatePayout records the call and returns the results of UpdatePayoutFunc
+func (m *PayoutService) UpdatePayout(p client.Payout) (*http.Response, error) {
+	m.record("UpdatePayout", p)
+	if m.UpdatePayoutFunc == nil {
+		return nil, notSet("PayoutService.UpdatePayout")
+	}
+
+	return m.UpdatePayoutFunc(p)
+}
+
+// DeletePayout records the call and returns the results of DeletePayoutFunc
+func (m *PayoutService) DeletePayout(payoutID string) (*http.Response, error) {
+	m.record("DeletePayout", payoutID)
+	if m.DeletePayoutFunc == nil {
+		return nil, notSet("PayoutService.DeletePayout")
+	}
+
+	return m.DeletePayoutFunc(payoutID)
+}
+
+// CreatePayoutsReports records the call and returns the results of CreatePayoutsReportsFunc
+func (m *PayoutService) CreatePayoutsReports() (*http.Response, error) {
+	m.record("CreatePayoutsReports")
+	if m.CreatePayoutsReportsFunc == nil {
+		return nil, notSet("PayoutService.CreatePayoutsReports")
+	}
+
+	return m.CreatePayoutsReportsFunc()
+}
+
+// RateService is a mock of client.RateService
+type RateService struct {
+	Recorder
+
+	QueryRatesFunc         func() ([]client.Rate, *http.Response, error)
+	GetRateForCurrencyFunc func(currencyCode string) (*client.Rate, *http.Response, error)
+}
+
+// QueryRates records the call and returns the results of QueryRatesFunc
+func (m *RateService) QueryRates() ([]client.Rate, *http.Response, error) {
+	m.record("QueryRates")
+	if m.QueryRatesFunc == nil {
+		return nil, nil, notSet("RateService.QueryRates")
+	}
+
+	return m.QueryRatesFunc()
+}
+
+// GetRateForCurrency records the call and returns the results of GetRateForCurrencyFunc
+func (m *RateService) GetRateForCurrency(currencyCode string) (*client.Rate, *http.Response, error) {
+	m.record("GetRateForCurrency", currencyCode)
+	if m.GetRateForCurrencyFunc == nil {
+		return nil, nil, notSet("RateService.GetRateForCurrency")
+	}
+
+	return m.GetRateForCurrencyFunc(currencyCode)
+}
+
+// TokenService is a mock of client.TokenService
+type TokenService struct {
+	Recorder
+
+	NewTokenFunc    func(label string, clientID string, facade client.Facade) (client.TokenResp, error)
+	ClaimTokenFunc  func(label string, clientID string, pairingCode string) (client.TokenResp, error)
+	QueryTokensFunc func() ([]client.TokenResp, *http.Response, error)
+	GetTokenFunc    func(token string) (*client.TokenResp, *http.Response, error)
+}
+
+// NewToken records the call and returns the results of NewTokenFunc
+func (m *TokenService) NewToken(label string, clientID string, facade client.Facade) (client.TokenResp, error) {
+	m.record("NewToken", label, clientID, facade)
+	if m.NewTokenFunc == nil {
+		return client.TokenResp{}, notSet("TokenService.NewToken")
+	}
+
+	return m.NewTokenFunc(label, clientID, facade)
+}
+
+// ClaimToken records the call and returns the results of ClaimTokenFunc
+func (m *TokenService) ClaimToken(label string, clientID string, pairingCode string) (client.TokenResp, error) {
+	m.record("ClaimToken", label, clientID, pairingCode)
+	if m.ClaimTokenFunc == nil {
+		return client.TokenResp{}, notSet("TokenService.ClaimToken")
+	}
+
+	return m.ClaimTokenFunc(label, clientID, pairingCode)
+}
+
+// QueryTokens records the call and returns the results of QueryTokensFunc
+func (m *TokenService) QueryTokens() ([]client.TokenResp, *http.Response, error) {
+	m.record("QueryTokens")
+	if m.QueryTokensFunc == nil {
+		return nil, nil, notSet("TokenService.QueryTokens")
+	}
+
+	return m.QueryTokensFunc()
+}
+
+// GetToken records the call and returns the results of GetTokenFunc
+func (m *TokenService) GetToken(token string) (*client.TokenResp, *http.Response, error) {
+	m.record("GetToken", token)
+	if m.GetTokenFunc == nil {
+		return nil, nil, notSet("TokenService.GetToken")
+	}
+
+	return m.GetTokenFunc(token)
+}
+
+// UserService is a mock of client.UserService
+type UserService struct {
+	Recorder
+
+	GetUserFunc    func() (*client.User, *http.Response, error)
+	UpdateUserFunc func(u client.User) (*client.User, *http.Response, error)
+}
+
+// GetUser records the call and returns the results of GetUserFunc
+func (m *UserService) GetUser() (*client.User, *http.Response, error) {
+	m.record("GetUser")
+	if m.GetUserFunc == nil {
+		return nil, nil, notSet("UserService.GetUser")
+	}
+
+	return m.GetUserFunc()
+}
+
+// UpdateUser records the call and returns the results of UpdateUserFunc
+func (m *UserService) UpdateUser(u client.User) (*client.User, *http.Response, error) {
+	m.record("UpdateUser", u)
+	if m.UpdateUserFunc == nil {
+		return nil, nil, notSet("UserService.UpdateUser")
+	}
+
+	return m.UpdateUserFunc(u)
+}
@@ -2,10 +2,67 @@ package client
 
 // https://test.bitpay.com/api#resource-Clients
 
+import (
+	"fmt"
+	"net/http"
+)
+
 type (
-	// BitpayClient maps to a resource in clients endpoint
+	// BitpayClient maps to a resource in clients endpoint, a client ID (SIN)
+	// paired with the merchant account
 	BitpayClient struct {
-		ID    string `json:"id"`
-		Label string `json:"label"`
+		ID          string      `json:"id"`
+		Label       string      `json:"label"`
+		DateCreated int64       `json:"dateCreated,omitempty"`
+		Tokens      []TokenResp `json:"tokens,omitempty"`
 	}
 )
+
+// Facades returns the facades of the tokens issued to the client
+func (b BitpayClient) Facades() []Facade {
+	var facades []Facade
+	for _, t := range b.Tokens {
+		if t.Facade != nil {
+			facades = append(facades, *t.Facade)
+		}
+	}
+
+	return facades
+}
+
+// QueryClients returns the client IDs paired with the merchant account
+func (c *Client) QueryClients() ([]BitpayClient, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/clients", c.apiBase), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var clients []BitpayClient
+	resp, err := c.Send(req, &clients)
+
+	return clients, resp, err
+}
+
+// GetClient returns the specified client by ID along with its tokens
+func (c *Client) GetClient(clientID string) (*BitpayClient, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/clients/%s", c.apiBase, clientID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var client BitpayClient
+	resp, err := c.Send(req, &client)
+
+	return &client, resp, err
+}
+
+// DeleteClient revokes the specified client ID and all of its tokens, e.g.
+// when its private key was compromised
+func (c *Client) DeleteClient(clientID string) (*http.Response, error) {
+	req, err := c.NewRequestWithAuth("DELETE", fmt.Sprintf("%s/clients/%s", c.apiBase, clientID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Send(req, nil)
+}
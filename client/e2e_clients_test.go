@@ -0,0 +1,71 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fundary/bitpay/bitpaytest"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClients(t *testing.T) {
+	withContext(func(bitpay *Client) {
+		Convey("With the clients endpoint", t, func() {
+			Convey("Retrieving all clients should include the calling client", func() {
+				clients, resp, err := bitpay.QueryClients()
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+				var ids []string
+				for _, c := range clients {
+					ids = append(ids, c.ID)
+				}
+				So(ids, ShouldContain, bitpay.ClientID())
+			})
+
+			Convey("Retrieving the calling client should be successful", func() {
+				client, resp, err := bitpay.GetClient(bitpay.ClientID())
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(client.ID, ShouldEqual, bitpay.ClientID())
+			})
+		})
+	})
+}
+
+func TestRevokeClient(t *testing.T) {
+	Convey("With a second client ID paired to the fake API", t, func() {
+		server := bitpaytest.NewServer()
+		defer server.Close()
+
+		_, clientID, err := DeriveIdentity(testPrivateKey)
+		So(err, ShouldBeNil)
+		bitpay := NewClientWithAuth(testPrivateKey, server.AddToken(clientID, string(FacadeMerchant)), server.URL)
+
+		otherID := "TfLgB8tzxxwsefunU3Ec8cjt81bJuvYxX1P"
+		server.AddToken(otherID, string(FacadeMerchant))
+
+		Convey("Revoking it should be successful", func() {
+			resp, err := bitpay.DeleteClient(otherID)
+
+			So(err, ShouldBeNil)
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+			clients, _, err := bitpay.QueryClients()
+			So(err, ShouldBeNil)
+
+			var ids []string
+			for _, c := range clients {
+				ids = append(ids, c.ID)
+			}
+			So(ids, ShouldContain, clientID)
+			So(ids, ShouldNotContain, otherID)
+
+			_, _, err = bitpay.GetClient(otherID)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
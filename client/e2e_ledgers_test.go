@@ -0,0 +1,34 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLedgers(t *testing.T) {
+	withContext(func(bitpay *Client) {
+		Convey("With the ledgers endpoint", t, func() {
+			Convey("Retrieving all ledgers should be successful", func() {
+				ledgers, resp, err := bitpay.QueryLedgers()
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(len(ledgers), ShouldBeGreaterThan, 0)
+				So(ledgers[0].Currency, ShouldNotEqual, "")
+			})
+
+			Convey("Retrieving the BTC ledger over several pages should be successful", func() {
+				end := time.Now()
+				start := end.AddDate(0, 0, -3*LedgerPageDays)
+
+				_, resp, err := bitpay.GetLedger("BTC", start, end)
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			})
+		})
+	})
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokens(t *testing.T) {
+	withContext(func(bitpay *Client) {
+		Convey("With the tokens endpoint", t, func() {
+			Convey("Retrieving all tokens should include the client token", func() {
+				tokens, resp, err := bitpay.QueryTokens()
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+
+				var values []string
+				for _, t := range tokens {
+					values = append(values, t.Token)
+				}
+				So(values, ShouldContain, bitpay.token)
+			})
+		})
+	})
+}
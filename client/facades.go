@@ -0,0 +1,335 @@
+package client
+
+// https://test.bitpay.com/api#facades
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type (
+	// TokenSet holds one token per facade
+	TokenSet map[Facade]string
+
+	// route describes which facades can call an endpoint, in order of
+	// preference, and names the operation it performs. Path segments
+	// starting with a colon match any value.
+	route struct {
+		method    string
+		path      string
+		facades   []Facade
+		operation string
+	}
+
+	// facadeTokens holds the tokens of a client by facade
+	facadeTokens struct {
+		sync.RWMutex
+		tokens map[Facade]TokenResp
+	}
+
+	// FacadeError is returned, before anything is sent, for calls the
+	// configured tokens aren't allowed to make
+	FacadeError struct {
+		Method string
+		Path   string
+
+		// Allowed lists the facades that can call the endpoint
+		Allowed []Facade
+
+		// Configured lists the facades of the tokens held by the client
+		Configured []Facade
+
+		// Reason explains why an allowed token was rejected, if any was
+		Reason string
+	}
+)
+
+var (
+	merchantOnly = []Facade{FacadeMerchant}
+	posFirst     = []Facade{FacadePOS, FacadeMerchant}
+	payrollFirst = []Facade{FacadePayroll, FacadeMerchant}
+
+	// defaultFacades is the order tokens are picked in for endpoints without
+	// a facade requirement
+	defaultFacades = []Facade{FacadeMerchant, FacadePayroll, FacadePOS, FacadePublic}
+
+	routes = []route{
+		{"POST", "/invoices", posFirst, "CreateInvoice"},
+		{"GET", "/invoices", merchantOnly, "QueryInvoices"},
+		{"GET", "/invoices/:id", posFirst, "GetInvoice"},
+		{"GET", "/invoices/:id/events", posFirst, "GetInvoiceEvents"},
+		{"POST", "/invoices/:id/refunds", merchantOnly, "CreateInvoiceRefund"},
+		{"GET", "/invoices/:id/refunds", merchantOnly, "QueryInvoiceRefunds"},
+		{"GET", "/invoices/:id/refunds/:id", merchantOnly, "GetInvoiceRefund"},
+		{"DELETE", "/invoices/:id/refunds/:id", merchantOnly, "DeleteInvoiceRefund"},
+		{"POST", "/invoices/:id/notifications", merchantOnly, "CreateInvoiceNotification"},
+
+		{"POST", "/bills", merchantOnly, "CreateBill"},
+		{"GET", "/bills", merchantOnly, "QueryBills"},
+		{"GET", "/bills/:id", merchantOnly, "GetBill"},
+		{"PUT", "/bills/:id", merchantOnly, "UpdateBill"},
+
+		{"POST", "/payouts", payrollFirst, "CreatePayout"},
+		{"GET", "/payouts", payrollFirst, "QueryPayouts"},
+		{"PUT", "/payouts", payrollFirst, "UpdatePayout"},
+		{"GET", "/payouts/:id", payrollFirst, "GetPayout"},
+		{"DELETE", "/payouts/:id", payrollFirst, "DeletePayout"},
+		{"POST", "/reports/payouts", payrollFirst, "CreatePayoutsReports"},
+
+		{"GET", "/ledgers", merchantOnly, "QueryLedgers"},
+		{"GET", "/ledgers/:currency", merchantOnly, "GetLedger"},
+
+		{"GET", "/clients", merchantOnly, "QueryClients"},
+		{"GET", "/clients/:id", merchantOnly, "GetClient"},
+		{"DELETE", "/clients/:id", merchantOnly, "DeleteClient"},
+
+		{"GET", "/user", merchantOnly, "GetUser"},
+		{"PUT", "/user", merchantOnly, "UpdateUser"},
+
+		// Tokens are listed by client ID, any token will do
+		{"GET", "/tokens", nil, "QueryTokens"},
+		{"GET", "/tokens/:token", nil, "GetToken"},
+		{"POST", "/tokens", nil, "CreateToken"},
+
+		// Public endpoints
+		{"GET", "/rates", nil, "QueryRates"},
+		{"GET", "/rates/:currency", nil, "GetRateForCurrency"},
+		{"GET", "/currencies", nil, "QueryCurrencies"},
+		{"POST", "/sessions", nil, "CreateSession"},
+		{"POST", "/applications", nil, "CreateApplication"},
+	}
+)
+
+// findRoute returns the route matching a request, the path is relative to the
+// API base
+func findRoute(method, path string) (route, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for _, r := range routes {
+		if r.method != method {
+			continue
+		}
+
+		pattern := strings.Split(strings.Trim(r.path, "/"), "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+
+		match := true
+		for i, p := range pattern {
+			if !strings.HasPrefix(p, ":") && p != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return r, true
+		}
+	}
+
+	return route{}, false
+}
+
+// endpoint returns the path pattern of the route of a request, e.g.
+// /invoices/:id, or the path of the request with all but its first segment
+// replaced for endpoints unknown to the client, so it can label metrics
+func (c *Client) endpoint(req *http.Request) string {
+	path := c.routePath(req.URL)
+	if r, ok := findRoute(req.Method, path); ok {
+		return r.path
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		segments[i] = ":id"
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+// Allows returns true if the facade can call the endpoint, path being
+// relative to the API base. Endpoints unknown to the client are allowed.
+func (f Facade) Allows(method, path string) bool {
+	r, ok := findRoute(method, path)
+	if !ok || len(r.facades) == 0 {
+		return true
+	}
+
+	for _, allowed := range r.facades {
+		if f == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *FacadeError) Error() string {
+	msg := fmt.Sprintf("%s %s requires a %s token", e.Method, e.Path, joinFacades(e.Allowed, " or "))
+	if e.Reason != "" {
+		return msg + ", " + e.Reason
+	}
+	if len(e.Configured) == 0 {
+		return msg + ", no tokens are configured"
+	}
+
+	return msg + ", the client only has " + joinFacades(e.Configured, ", ") + " tokens"
+}
+
+// SetToken sets the token used for calls requiring the given facade
+func (c *Client) SetToken(facade Facade, token string) {
+	f := facade
+	c.AddToken(TokenResp{Token: token, Facade: &f})
+}
+
+// AddToken sets a token by its facade, its policies are checked before each
+// call it is used for
+func (c *Client) AddToken(t TokenResp) {
+	c.tokens.Lock()
+	defer c.tokens.Unlock()
+
+	c.tokens.tokens[t.FacadeName()] = t
+}
+
+// LoadTokens fetches the tokens held by the client ID and adds them, so the
+// facade of the token the client was created with is known as well
+func (c *Client) LoadTokens() (*http.Response, error) {
+	tokens, resp, err := c.QueryTokens()
+	if err != nil {
+		return resp, err
+	}
+
+	for _, t := range tokens {
+		if t.FacadeName() != "" {
+			c.AddToken(t)
+		}
+	}
+
+	return resp, nil
+}
+
+// Tokens returns the tokens configured on the client by facade
+func (c *Client) Tokens() TokenSet {
+	c.tokens.RLock()
+	defer c.tokens.RUnlock()
+
+	tokens := make(TokenSet)
+	for f, t := range c.tokens.tokens {
+		tokens[f] = t.Token
+	}
+
+	return tokens
+}
+
+// tokenFor returns the token to authenticate a request with. The token of the
+// most preferred facade allowed on the endpoint is used, falling back to the
+// token the client was created with as long as its facade is unknown. Such
+// calls are sent unchecked, and rejected by the API if the facade of the
+// token doesn't allow them.
+func (c *Client) tokenFor(method string, u *url.URL) (string, error) {
+	c.tokens.RLock()
+	defer c.tokens.RUnlock()
+
+	r, ok := findRoute(method, c.routePath(u))
+	if !ok || len(r.facades) == 0 {
+		if c.token != "" {
+			return c.token, nil
+		}
+		for _, f := range defaultFacades {
+			if t, ok := c.tokens.tokens[f]; ok {
+				return t.Token, nil
+			}
+		}
+
+		return "", nil
+	}
+
+	reason := ""
+	for _, f := range r.facades {
+		t, ok := c.tokens.tokens[f]
+		if !ok {
+			continue
+		}
+		if reason = c.policyViolation(t); reason == "" {
+			return t.Token, nil
+		}
+	}
+
+	if c.token != "" && !c.knownToken(c.token) {
+		return c.token, nil
+	}
+
+	err := &FacadeError{
+		Method:  method,
+		Path:    r.path,
+		Allowed: r.facades,
+		Reason:  reason,
+	}
+	for _, f := range defaultFacades {
+		if _, ok := c.tokens.tokens[f]; ok {
+			err.Configured = append(err.Configured, f)
+		}
+	}
+
+	return "", err
+}
+
+// policyViolation returns why the policies of the token forbid its use by
+// the client, or an empty string if they don't
+func (c *Client) policyViolation(t TokenResp) string {
+	for _, p := range t.Policies {
+		if p.Policy != "id" {
+			continue
+		}
+
+		switch p.Method {
+		case "inactive":
+			return fmt.Sprintf("the %s token is awaiting pairing approval", t.FacadeName())
+		case "require":
+			allowed := len(p.Params) == 0
+			for _, id := range p.Params {
+				if id == c.ClientID() {
+					allowed = true
+				}
+			}
+			if !allowed {
+				return fmt.Sprintf("the %s token is restricted to client ID %s", t.FacadeName(), strings.Join(p.Params, ", "))
+			}
+		}
+	}
+
+	return ""
+}
+
+// knownToken returns true if the facade of the token is known
+func (c *Client) knownToken(token string) bool {
+	for _, t := range c.tokens.tokens {
+		if t.Token == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routePath returns the path of u relative to the API base
+func (c *Client) routePath(u *url.URL) string {
+	base, err := url.Parse(c.apiBase)
+	if err != nil {
+		return u.Path
+	}
+
+	return strings.TrimPrefix(u.Path, strings.TrimSuffix(base.Path, "/"))
+}
+
+func joinFacades(facades []Facade, sep string) string {
+	names := make([]string, len(facades))
+	for i, f := range facades {
+		names[i] = string(f)
+	}
+
+	return strings.Join(names, sep)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testPrivateKey = "1e99423a4ed27608a15a2616a2b0e9e52ced330ac530edcc32c8ffc6a526aedd"
+
+func TestFacadeTokens(t *testing.T) {
+	Convey("With a client holding a token per facade", t, func() {
+		bitpay := NewClientWithTokens(testPrivateKey, TokenSet{
+			FacadePOS:      "pos-token",
+			FacadeMerchant: "merchant-token",
+		}, APIBaseTest)
+
+		Convey("Invoices should be created with the pos token", func() {
+			req, err := bitpay.NewRequestWithAuth("POST", APIBaseTest+"/invoices", Invoice{Price: 10, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			var body map[string]interface{}
+			So(json.NewDecoder(req.Body).Decode(&body), ShouldBeNil)
+			So(body["token"], ShouldEqual, "pos-token")
+		})
+
+		Convey("Invoices should be retrieved with the pos token", func() {
+			req, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/invoices/abc", nil)
+
+			So(err, ShouldBeNil)
+			So(req.URL.Query().Get("token"), ShouldEqual, "pos-token")
+		})
+
+		Convey("Ledgers should be queried with the merchant token", func() {
+			req, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/ledgers/BTC?startDate=2015-01-01", nil)
+
+			So(err, ShouldBeNil)
+			So(req.URL.Query().Get("token"), ShouldEqual, "merchant-token")
+			So(req.URL.Query().Get("startDate"), ShouldEqual, "2015-01-01")
+		})
+
+		Convey("Payouts should be rejected locally with a pos token", func() {
+			bitpay := NewClientWithTokens(testPrivateKey, TokenSet{FacadePOS: "pos-token"}, APIBaseTest)
+
+			_, err := bitpay.CreatePayout(Payout{Amount: 100, Currency: "USD"})
+
+			So(err, ShouldHaveSameTypeAs, &FacadeError{})
+			So(err.(*FacadeError).Allowed, ShouldResemble, []Facade{FacadePayroll, FacadeMerchant})
+			So(err.(*FacadeError).Configured, ShouldResemble, []Facade{FacadePOS})
+			So(err.Error(), ShouldEqual, "POST /payouts requires a payroll or merchant token, the client only has pos tokens")
+		})
+
+		Convey("A token awaiting pairing approval should be rejected", func() {
+			merchant := FacadeMerchant
+			bitpay := NewClientWithTokens(testPrivateKey, TokenSet{}, APIBaseTest)
+			bitpay.AddToken(TokenResp{
+				Token:    "merchant-token",
+				Facade:   &merchant,
+				Policies: []Policy{{Policy: "id", Method: "inactive", Params: []string{bitpay.ClientID()}}},
+			})
+
+			_, _, err := bitpay.QueryLedgers()
+
+			So(err, ShouldHaveSameTypeAs, &FacadeError{})
+			So(err.Error(), ShouldEqual, "GET /ledgers requires a merchant token, the merchant token is awaiting pairing approval")
+		})
+
+		Convey("A token restricted to another client ID should be rejected", func() {
+			merchant := FacadeMerchant
+			bitpay.AddToken(TokenResp{
+				Token:    "merchant-token",
+				Facade:   &merchant,
+				Policies: []Policy{{Policy: "id", Method: "require", Params: []string{"TfOther"}}},
+			})
+
+			_, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/ledgers", nil)
+
+			So(err, ShouldHaveSameTypeAs, &FacadeError{})
+			So(err.(*FacadeError).Reason, ShouldEqual, "the merchant token is restricted to client ID TfOther")
+		})
+
+		Convey("The token of the client should not be used once its facade is known", func() {
+			pos := FacadePOS
+			bitpay := NewClientWithAuth(testPrivateKey, "pos-token", APIBaseTest)
+			bitpay.AddToken(TokenResp{Token: "pos-token", Facade: &pos})
+
+			_, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/ledgers", nil)
+
+			So(err, ShouldHaveSameTypeAs, &FacadeError{})
+		})
+
+		Convey("Facades should know the endpoints they can call", func() {
+			So(FacadePOS.Allows("POST", "/invoices"), ShouldBeTrue)
+			So(FacadePOS.Allows("GET", "/ledgers/BTC"), ShouldBeFalse)
+			So(FacadeMerchant.Allows("DELETE", "/invoices/abc/refunds/def"), ShouldBeTrue)
+			So(FacadePOS.Allows("GET", "/unknown"), ShouldBeTrue)
+		})
+
+		Convey("The token of the client should be used unchecked while its facade is unknown", func() {
+			bitpay := NewClientWithAuth(testPrivateKey, "any-token", APIBaseTest)
+
+			req, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/payouts", nil)
+
+			So(err, ShouldBeNil)
+			So(req.URL.Query().Get("token"), ShouldEqual, "any-token")
+		})
+
+		Convey("The token of the client should be checked once its facade is loaded", func() {
+			bitpay := NewClientWithAuth(testPrivateKey, "any-token", APIBaseTest)
+			bitpay.SetToken(FacadePOS, "any-token")
+
+			_, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/payouts", nil)
+
+			So(err, ShouldHaveSameTypeAs, &FacadeError{})
+		})
+
+		Convey("Tokens should be listed by facade", func() {
+			bitpay.SetToken(FacadePayroll, "payroll-token")
+
+			So(bitpay.Tokens(), ShouldResemble, TokenSet{
+				FacadePOS:      "pos-token",
+				FacadeMerchant: "merchant-token",
+				FacadePayroll:  "payroll-token",
+			})
+		})
+	})
+}
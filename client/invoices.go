@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // https://test.bitpay.com/api#resource-Invoices
@@ -10,12 +11,22 @@ import (
 var (
 	InvoiceAdjustmentAcceptUnderpayment InvoiceAdjustment = "acceptUnderpayment"
 	InvoiceAdjustmentAcceptOverpayment  InvoiceAdjustment = "acceptOverpayment"
+
+	InvoiceStatusNew       InvoiceStatus = "new"
+	InvoiceStatusPaid      InvoiceStatus = "paid"
+	InvoiceStatusConfirmed InvoiceStatus = "confirmed"
+	InvoiceStatusComplete  InvoiceStatus = "complete"
+	InvoiceStatusExpired   InvoiceStatus = "expired"
+	InvoiceStatusInvalid   InvoiceStatus = "invalid"
 )
 
 type (
 	// InvoiceAdjustment is used when accepting the overpayment or underpayment for an invoice.
 	InvoiceAdjustment string
 
+	// InvoiceStatus is the state of an invoice in its payment lifecycle
+	InvoiceStatus string
+
 	// Invoice maps to a resource at the invoices endpoint
 	Invoice struct {
 		ID                string `json:"id,omitempty"`
@@ -32,6 +43,12 @@ type (
 		FullNotifications string `json:"fullNotifications,omitempty"`
 		Physical          string `json:"physical,omitempty"`
 		Buyer             Buyer  `json:"buyer,omitempty"`
+
+		// Fields set by Bitpay
+		URL            string        `json:"url,omitempty"`
+		Status         InvoiceStatus `json:"status,omitempty"`
+		InvoiceTime    int64         `json:"invoiceTime,omitempty"`
+		ExpirationTime int64         `json:"expirationTime,omitempty"`
 	}
 
 	// Buyer maps to the buyer object in an Invoice
@@ -64,6 +81,11 @@ type (
 	}
 )
 
+// CreatedAt returns the time the invoice was created at
+func (i Invoice) CreatedAt() time.Time {
+	return time.Unix(0, i.InvoiceTime*int64(time.Millisecond))
+}
+
 // CreateInvoice creates an invoice for the calling merchant
 func (c *Client) CreateInvoice(i Invoice) (*http.Response, error) {
 	req, err := c.NewRequestWithAuth("POST", fmt.Sprintf("%s/invoices", c.apiBase), i)
@@ -147,7 +169,7 @@ func (c *Client) AcceptInvoiceAdjustment(invoiceID string, adjustment InvoiceAdj
 		return nil, err
 	}
 
-	return c.Send(req, nil)
+	return c.Send(withOperation(req, "AcceptInvoiceAdjustment"), nil)
 }
 
 // CreateInvoiceNotification resends the IPN for the specified invoice
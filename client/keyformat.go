@@ -0,0 +1,249 @@
+package client
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"github.com/conformal/btcec"
+)
+
+var (
+	// KeyFormatHex is a hex encoded private key, as printed by bitpay generate
+	KeyFormatHex KeyFormat = "hex"
+
+	// KeyFormatSEC1 is a PEM encoded "EC PRIVATE KEY", as stored by the
+	// Python and Ruby SDKs and openssl ec
+	KeyFormatSEC1 KeyFormat = "sec1"
+
+	// KeyFormatPKCS8 is a PEM encoded "PRIVATE KEY", as written by
+	// openssl pkcs8
+	KeyFormatPKCS8 KeyFormat = "pkcs8"
+
+	// KeyFormats lists the formats EncodePrivateKey supports
+	KeyFormats = []KeyFormat{KeyFormatHex, KeyFormatSEC1, KeyFormatPKCS8}
+
+	// ErrKeyPassphraseRequired is returned when decoding an encrypted key
+	// without a passphrase
+	ErrKeyPassphraseRequired = errors.New("the private key is encrypted, a passphrase is required")
+
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type (
+	// KeyFormat is an encoding of a private key
+	KeyFormat string
+
+	// ecPrivateKey is the SEC1 (RFC 5915) structure of an EC private key
+	ecPrivateKey struct {
+		Version       int
+		PrivateKey    []byte
+		NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+		PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+	}
+
+	// pkcs8PrivateKey is the PKCS#8 (RFC 5208) structure of a private key
+	pkcs8PrivateKey struct {
+		Version    int
+		Algo       pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+)
+
+// EncodePrivateKey encodes a hex encoded private key in format. The key is
+// written unencrypted, keep it in a keystore to encrypt it at rest.
+func EncodePrivateKey(privateKey string, format KeyFormat) ([]byte, error) {
+	if _, _, err := DeriveIdentity(privateKey); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case KeyFormatHex:
+		return []byte(privateKey + "\n"), nil
+
+	case KeyFormatSEC1:
+		der, err := marshalECPrivateKey(privateKey, true)
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+
+	case KeyFormatPKCS8:
+		inner, err := marshalECPrivateKey(privateKey, false)
+		if err != nil {
+			return nil, err
+		}
+
+		params, err := asn1.Marshal(oidSecp256k1)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err := asn1.Marshal(pkcs8PrivateKey{
+			Algo: pkix.AlgorithmIdentifier{
+				Algorithm:  oidPublicKeyECDSA,
+				Parameters: asn1.RawValue{FullBytes: params},
+			},
+			PrivateKey: inner,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	return nil, fmt.Errorf("unknown key format %s", format)
+}
+
+// DecodePrivateKey returns the hex encoded private key of a key in any of
+// the KeyFormats. SEC1 keys encrypted by openssl or the other SDKs are
+// decrypted with passphrase, ErrKeyPassphraseRequired is returned if it is
+// empty.
+func DecodePrivateKey(data, passphrase []byte) (string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		privateKey := strings.TrimSpace(string(data))
+		if _, _, err := DeriveIdentity(privateKey); err != nil {
+			return "", errors.New("the key is neither PEM nor hex encoded")
+		}
+
+		return strings.ToLower(privateKey), nil
+	}
+
+	der := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		if len(passphrase) == 0 {
+			return "", ErrKeyPassphraseRequired
+		}
+
+		var err error
+		der, err = x509.DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return parseECPrivateKey(der, nil)
+
+	case "PRIVATE KEY":
+		var key pkcs8PrivateKey
+		if _, err := asn1.Unmarshal(der, &key); err != nil {
+			return "", err
+		}
+		if !key.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+			return "", errors.New("the private key is not an EC key")
+		}
+
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(key.Algo.Parameters.FullBytes, &curve); err != nil {
+			return "", err
+		}
+
+		return parseECPrivateKey(key.PrivateKey, curve)
+
+	case "ENCRYPTED PRIVATE KEY":
+		return "", errors.New("encrypted PKCS#8 keys aren't supported, decrypt it with openssl pkcs8 first")
+	}
+
+	return "", fmt.Errorf("unsupported PEM block %s", block.Type)
+}
+
+// ReadPrivateKey reads a private key file in any of the KeyFormats or a
+// keystore, and returns the hex encoded private key. passphrase decrypts the
+// keystore or encrypted PEM.
+func ReadPrivateKey(filename string, passphrase []byte) (string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		var f keystoreFile
+		if err := json.Unmarshal(b, &f); err != nil || f.Crypto.Ciphertext == "" {
+			return "", fmt.Errorf("%s is not a keystore", filename)
+		}
+		if len(passphrase) == 0 {
+			return "", ErrKeyPassphraseRequired
+		}
+
+		k, err := OpenKeystore(filename, passphrase)
+		if err != nil {
+			return "", err
+		}
+
+		return k.PrivateKey, nil
+	}
+
+	return DecodePrivateKey(b, passphrase)
+}
+
+func marshalECPrivateKey(privateKey string, withCurve bool) ([]byte, error) {
+	d, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), d)
+	uncompressed := pub.SerializeUncompressed()
+
+	key := ecPrivateKey{
+		Version:    1,
+		PrivateKey: padKey(d),
+		PublicKey:  asn1.BitString{Bytes: uncompressed, BitLength: 8 * len(uncompressed)},
+	}
+	if withCurve {
+		key.NamedCurveOID = oidSecp256k1
+	}
+
+	return asn1.Marshal(key)
+}
+
+// parseECPrivateKey parses a SEC1 key, curve is the one given by a PKCS#8
+// wrapper if any
+func parseECPrivateKey(der []byte, curve asn1.ObjectIdentifier) (string, error) {
+	var key ecPrivateKey
+	if _, err := asn1.Unmarshal(der, &key); err != nil {
+		return "", err
+	}
+	if key.Version != 1 {
+		return "", fmt.Errorf("unsupported EC private key version %d", key.Version)
+	}
+
+	if len(key.NamedCurveOID) > 0 {
+		curve = key.NamedCurveOID
+	}
+	if curve != nil && !curve.Equal(oidSecp256k1) {
+		return "", fmt.Errorf("the private key is on curve %s, not secp256k1", curve)
+	}
+
+	d := new(big.Int).SetBytes(key.PrivateKey)
+	if d.Sign() == 0 || d.Cmp(btcec.S256().N) >= 0 {
+		return "", errors.New("invalid private key")
+	}
+
+	return hex.EncodeToString(padKey(key.PrivateKey)), nil
+}
+
+// padKey left pads a private key to 32 bytes
+func padKey(d []byte) []byte {
+	d = bytes.TrimLeft(d, "\x00")
+	if len(d) >= 32 {
+		return d
+	}
+
+	return append(make([]byte, 32-len(d)), d...)
+}
@@ -0,0 +1,362 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fundary/bitauth"
+	"golang.org/x/crypto/scrypt"
+)
+
+const keystoreVersion = 1
+
+var (
+	// KeystoreScryptN is the scrypt CPU/memory cost used when saving a
+	// keystore. Opening a keystore uses the cost it was saved with.
+	KeystoreScryptN = 1 << 15
+
+	// ErrKeystorePassphrase is returned when a keystore can't be decrypted
+	ErrKeystorePassphrase = errors.New("invalid keystore passphrase")
+)
+
+// Bounds of the scrypt parameters read from a keystore, so a crafted file
+// can't make opening it exhaust the memory or the CPU
+const (
+	keystoreMaxScryptN      = 1 << 20
+	keystoreMaxScryptR      = 16
+	keystoreMaxScryptP      = 4
+	keystoreMaxScryptMemory = 1 << 30
+	keystoreKeyLen          = 32
+)
+
+type (
+	// Keystore holds a private key and the tokens paired with its client ID,
+	// encrypted at rest with a passphrase. The key used to encrypt it is
+	// derived with scrypt and the contents are sealed with AES-256-GCM.
+	Keystore struct {
+		PrivateKey string
+		PublicKey  string
+		SIN        string
+		Tokens     map[Facade]TokenResp
+
+		// mu guards the identity against key rotations while signing
+		mu         sync.RWMutex
+		path       string
+		passphrase []byte
+	}
+
+	// keystoreFile is the on-disk format of a keystore, the identity is stored
+	// in clear so a keystore can be told apart without its passphrase
+	keystoreFile struct {
+		Version   int            `json:"version"`
+		SIN       string         `json:"sin"`
+		PublicKey string         `json:"publicKey"`
+		Crypto    keystoreCrypto `json:"crypto"`
+	}
+
+	keystoreCrypto struct {
+		KDF        string         `json:"kdf"`
+		KDFParams  keystoreScrypt `json:"kdfparams"`
+		Cipher     string         `json:"cipher"`
+		Nonce      string         `json:"nonce"`
+		Ciphertext string         `json:"ciphertext"`
+	}
+
+	keystoreScrypt struct {
+		N      int    `json:"n"`
+		R      int    `json:"r"`
+		P      int    `json:"p"`
+		KeyLen int    `json:"keylen"`
+		Salt   string `json:"salt"`
+	}
+
+	// keystoreSecrets is the encrypted part of a keystore
+	keystoreSecrets struct {
+		PrivateKey string               `json:"privateKey"`
+		Tokens     map[Facade]TokenResp `json:"tokens"`
+	}
+)
+
+// CreateKeystore creates a keystore at path for a hex encoded private key, a
+// new key is generated if privateKey is empty. It fails if path exists.
+func CreateKeystore(path string, passphrase []byte, privateKey string) (*Keystore, error) {
+	if privateKey == "" {
+		sin, err := bitauth.GenerateSIN()
+		if err != nil {
+			return nil, err
+		}
+		privateKey = hex.EncodeToString(sin.PrivateKey)
+	}
+
+	k := &Keystore{
+		Tokens:     make(map[Facade]TokenResp),
+		path:       path,
+		passphrase: passphrase,
+	}
+	if err := k.setPrivateKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	// Claim the path before saving, so concurrent creations can't both
+	// succeed and overwrite each other
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("keystore %s already exists", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if err := k.Save(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// OpenKeystore decrypts the keystore at path
+func OpenKeystore(path string, passphrase []byte) (*Keystore, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f keystoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", f.Version)
+	}
+	if f.Crypto.KDF != "scrypt" || f.Crypto.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported keystore encryption %s/%s", f.Crypto.KDF, f.Crypto.Cipher)
+	}
+
+	salt, err := hex.DecodeString(f.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(f.Crypto.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(f.Crypto.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	p := f.Crypto.KDFParams
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreAEAD(passphrase, salt, p.N, p.R, p.P, p.KeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(f.SIN+f.PublicKey))
+	if err != nil {
+		return nil, ErrKeystorePassphrase
+	}
+
+	var secrets keystoreSecrets
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+
+	k := &Keystore{
+		Tokens:     secrets.Tokens,
+		path:       path,
+		passphrase: passphrase,
+	}
+	if k.Tokens == nil {
+		k.Tokens = make(map[Facade]TokenResp)
+	}
+	if err := k.setPrivateKey(secrets.PrivateKey); err != nil {
+		return nil, err
+	}
+	if k.SIN != f.SIN {
+		return nil, fmt.Errorf("keystore %s was tampered with, its private key doesn't match client ID %s", path, f.SIN)
+	}
+
+	return k, nil
+}
+
+// NewClientFromKeystore returns a new client with the key and tokens of the
+// keystore
+func NewClientFromKeystore(k *Keystore, APIBase string) *Client {
+	client := NewClientWithSigner(k.Signer(), "", APIBase)
+	for _, t := range k.Tokens {
+		client.AddToken(t)
+	}
+
+	return client
+}
+
+// Path returns the file the keystore is saved to
+func (k *Keystore) Path() string {
+	return k.path
+}
+
+// Save encrypts the keystore with a fresh salt and nonce and replaces the
+// file atomically
+func (k *Keystore) Save() error {
+	k.mu.RLock()
+	sin, publicKey := k.SIN, k.PublicKey
+	plaintext, err := json.Marshal(keystoreSecrets{PrivateKey: k.PrivateKey, Tokens: k.Tokens})
+	k.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+
+	params := keystoreScrypt{N: KeystoreScryptN, R: 8, P: 1, KeyLen: keystoreKeyLen, Salt: hex.EncodeToString(salt)}
+	aead, err := keystoreAEAD(k.passphrase, salt, params.N, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(keystoreFile{
+		Version:   keystoreVersion,
+		SIN:       sin,
+		PublicKey: publicKey,
+		Crypto: keystoreCrypto{
+			KDF:        "scrypt",
+			KDFParams:  params,
+			Cipher:     "aes-256-gcm",
+			Nonce:      hex.EncodeToString(nonce),
+			Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, plaintext, []byte(sin+publicKey))),
+		},
+	}, "", "	")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(k.path), ".keystore")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), k.path)
+}
+
+// ChangePassphrase re-encrypts the keystore with a new passphrase
+func (k *Keystore) ChangePassphrase(passphrase []byte) error {
+	k.passphrase = passphrase
+
+	return k.Save()
+}
+
+// RotateKey replaces the private key of the keystore with a new one. The
+// tokens are dropped, as they are bound to the previous client ID, which
+// should be revoked once the new one is paired.
+func (k *Keystore) RotateKey() error {
+	sin, err := bitauth.GenerateSIN()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	err = k.setPrivateKey(hex.EncodeToString(sin.PrivateKey))
+	if err == nil {
+		k.Tokens = make(map[Facade]TokenResp)
+	}
+	k.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return k.Save()
+}
+
+// StoreToken implements TokenStore, the keystore is saved right away
+func (k *Keystore) StoreToken(t TokenResp) error {
+	k.mu.Lock()
+	k.Tokens[t.FacadeName()] = t
+	k.mu.Unlock()
+
+	return k.Save()
+}
+
+// TokenSet returns the tokens of the keystore by facade
+func (k *Keystore) TokenSet() TokenSet {
+	tokens := make(TokenSet)
+	for f, t := range k.Tokens {
+		tokens[f] = t.Token
+	}
+
+	return tokens
+}
+
+func (k *Keystore) setPrivateKey(privateKey string) error {
+	publicKey, sin, err := DeriveIdentity(privateKey)
+	if err != nil {
+		return err
+	}
+
+	k.PrivateKey = privateKey
+	k.PublicKey = publicKey
+	k.SIN = sin
+
+	return nil
+}
+
+// check rejects scrypt parameters out of the bounds a keystore is saved with
+func (p keystoreScrypt) check() error {
+	switch {
+	case p.N < 2 || p.N > keystoreMaxScryptN || p.N&(p.N-1) != 0:
+		return fmt.Errorf("unsupported keystore scrypt cost %d", p.N)
+	case p.R < 1 || p.R > keystoreMaxScryptR || p.P < 1 || p.P > keystoreMaxScryptP:
+		return fmt.Errorf("unsupported keystore scrypt parameters r=%d p=%d", p.R, p.P)
+	case 128*p.N*p.R > keystoreMaxScryptMemory:
+		return fmt.Errorf("keystore scrypt parameters N=%d r=%d require too much memory", p.N, p.R)
+	case p.KeyLen != keystoreKeyLen:
+		return fmt.Errorf("unsupported keystore key length %d", p.KeyLen)
+	}
+
+	return nil
+}
+
+func keystoreAEAD(passphrase, salt []byte, n, r, p, keyLen int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, n, r, p, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeystore(t *testing.T) {
+	Convey("With a keystore", t, func() {
+		defer func(n int) { KeystoreScryptN = n }(KeystoreScryptN)
+		KeystoreScryptN = 1 << 10
+
+		dir, err := ioutil.TempDir("", "bitpay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "keystore.json")
+
+		k, err := CreateKeystore(path, []byte("secret"), testPrivateKey)
+		So(err, ShouldBeNil)
+
+		Convey("The private key should not be stored in clear", func() {
+			b, err := ioutil.ReadFile(path)
+
+			So(err, ShouldBeNil)
+			So(string(b), ShouldNotContainSubstring, testPrivateKey)
+			So(string(b), ShouldContainSubstring, k.SIN)
+		})
+
+		Convey("Opening it should restore the key and tokens", func() {
+			So(k.StoreToken(TokenResp{Token: "merchant-token", Facade: &FacadeMerchant}), ShouldBeNil)
+
+			opened, err := OpenKeystore(path, []byte("secret"))
+
+			So(err, ShouldBeNil)
+			So(opened.PrivateKey, ShouldEqual, testPrivateKey)
+			So(opened.SIN, ShouldEqual, k.SIN)
+			So(opened.TokenSet(), ShouldResemble, TokenSet{FacadeMerchant: "merchant-token"})
+
+			bitpay := NewClientFromKeystore(opened, APIBaseTest)
+			So(bitpay.ClientID(), ShouldEqual, k.SIN)
+			So(bitpay.Tokens(), ShouldResemble, TokenSet{FacadeMerchant: "merchant-token"})
+		})
+
+		Convey("Opening it with a wrong passphrase should fail", func() {
+			_, err := OpenKeystore(path, []byte("wrong"))
+
+			So(err, ShouldEqual, ErrKeystorePassphrase)
+		})
+
+		Convey("Creating it twice should fail", func() {
+			_, err := CreateKeystore(path, []byte("secret"), "")
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Opening it with out of bounds scrypt parameters should fail", func() {
+			b, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte(strings.Replace(string(b), `"n": 1024`, `"n": 1073741824`, 1)), 0600), ShouldBeNil)
+
+			_, err = OpenKeystore(path, []byte("secret"))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "unsupported keystore scrypt cost 1073741824")
+		})
+
+		Convey("Changing its passphrase should re-encrypt it", func() {
+			So(k.ChangePassphrase([]byte("new secret")), ShouldBeNil)
+
+			_, err := OpenKeystore(path, []byte("secret"))
+			So(err, ShouldEqual, ErrKeystorePassphrase)
+
+			opened, err := OpenKeystore(path, []byte("new secret"))
+			So(err, ShouldBeNil)
+			So(opened.PrivateKey, ShouldEqual, testPrivateKey)
+		})
+
+		Convey("Rotating its key should drop the tokens", func() {
+			So(k.StoreToken(TokenResp{Token: "merchant-token", Facade: &FacadeMerchant}), ShouldBeNil)
+			sin := k.SIN
+
+			So(k.RotateKey(), ShouldBeNil)
+
+			opened, err := OpenKeystore(path, []byte("secret"))
+			So(err, ShouldBeNil)
+			So(opened.SIN, ShouldNotEqual, sin)
+			So(opened.PrivateKey, ShouldNotEqual, testPrivateKey)
+			So(opened.Tokens, ShouldBeEmpty)
+		})
+	})
+}
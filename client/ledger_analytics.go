@@ -0,0 +1,304 @@
+package client
+
+import (
+	"sort"
+	"time"
+)
+
+var (
+	LedgerPeriodDay   LedgerPeriod = "day"
+	LedgerPeriodWeek  LedgerPeriod = "week"
+	LedgerPeriodMonth LedgerPeriod = "month"
+)
+
+type (
+	// LedgerPeriod is the length of the periods ledger entries are aggregated by
+	LedgerPeriod string
+
+	// LedgerAnalytics computes balances and aggregates over the ledger entries
+	// of one or more currencies
+	LedgerAnalytics struct {
+		entries map[string][]LedgerEntry
+		opening map[string]float64
+		closing map[string]float64
+	}
+
+	// BalancePoint is the balance of a currency right after an entry was booked
+	BalancePoint struct {
+		Entry   LedgerEntry `json:"entry"`
+		Balance float64     `json:"balance"`
+	}
+
+	// PeriodSummary aggregates the ledger entries of a currency over a period
+	PeriodSummary struct {
+		Currency   string                     `json:"currency"`
+		Start      time.Time                  `json:"start"`
+		End        time.Time                  `json:"end"`
+		Entries    int                        `json:"entries"`
+		Opening    float64                    `json:"opening"`
+		Closing    float64                    `json:"closing"`
+		Credits    float64                    `json:"credits"`
+		Debits     float64                    `json:"debits"`
+		ByCategory map[LedgerCategory]float64 `json:"byCategory"`
+	}
+
+	// PendingSettlement is an invoice expected to be credited to the ledger
+	PendingSettlement struct {
+		InvoiceID string        `json:"invoiceId"`
+		Status    InvoiceStatus `json:"status"`
+		Currency  string        `json:"currency"`
+		Amount    float64       `json:"amount"`
+		CreatedAt time.Time     `json:"createdAt"`
+	}
+)
+
+// NewLedgerAnalytics returns an empty LedgerAnalytics
+func NewLedgerAnalytics() *LedgerAnalytics {
+	return &LedgerAnalytics{
+		entries: make(map[string][]LedgerEntry),
+		opening: make(map[string]float64),
+		closing: make(map[string]float64),
+	}
+}
+
+// LoadLedgerAnalytics fetches the ledger entries booked since the given time
+// for each currency, all ledgers when none are given. Balances are anchored
+// to the current ledger balances, so BalanceAt is exact for any time after
+// since.
+func (c *Client) LoadLedgerAnalytics(since time.Time, currencies ...string) (*LedgerAnalytics, error) {
+	ledgers, _, err := c.QueryLedgers()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(currencies) == 0 {
+		for _, l := range ledgers {
+			currencies = append(currencies, l.Currency)
+		}
+	}
+
+	a := NewLedgerAnalytics()
+	now := time.Now()
+	for _, currency := range currencies {
+		entries, _, err := c.GetLedger(currency, since, now)
+		if err != nil {
+			return nil, err
+		}
+		a.Add(currency, entries)
+
+		for _, l := range ledgers {
+			if l.Currency == currency {
+				a.SetClosingBalance(currency, l.Balance)
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// Add adds ledger entries of a currency, entries are kept in chronological
+// order
+func (a *LedgerAnalytics) Add(currency string, entries []LedgerEntry) {
+	all := append(a.entries[currency], entries...)
+	sort.Stable(byTimestamp(all))
+	a.entries[currency] = all
+}
+
+// SetOpeningBalance sets the balance of a currency before its first entry
+func (a *LedgerAnalytics) SetOpeningBalance(currency string, balance float64) {
+	delete(a.closing, currency)
+	a.opening[currency] = balance
+}
+
+// SetClosingBalance sets the balance of a currency after its last entry, the
+// opening balance is derived from it, including entries added afterwards
+func (a *LedgerAnalytics) SetClosingBalance(currency string, balance float64) {
+	delete(a.opening, currency)
+	a.closing[currency] = balance
+}
+
+// openingBalance returns the balance of a currency before its first entry
+func (a *LedgerAnalytics) openingBalance(currency string) float64 {
+	balance, ok := a.closing[currency]
+	if !ok {
+		return a.opening[currency]
+	}
+
+	for _, e := range a.entries[currency] {
+		balance -= e.Value()
+	}
+
+	return balance
+}
+
+// Currencies returns the currencies with entries, sorted by code
+func (a *LedgerAnalytics) Currencies() []string {
+	var currencies []string
+	for currency := range a.entries {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	return currencies
+}
+
+// RunningBalance returns the balance of a currency after each of its entries
+func (a *LedgerAnalytics) RunningBalance(currency string) []BalancePoint {
+	balance := a.openingBalance(currency)
+	points := make([]BalancePoint, 0, len(a.entries[currency]))
+	for _, e := range a.entries[currency] {
+		balance += e.Value()
+		points = append(points, BalancePoint{Entry: e, Balance: balance})
+	}
+
+	return points
+}
+
+// BalanceAt returns the balance of a currency at the given time, including
+// entries booked at that exact time
+func (a *LedgerAnalytics) BalanceAt(currency string, t time.Time) float64 {
+	balance := a.openingBalance(currency)
+	for _, e := range a.entries[currency] {
+		if e.Timestamp.After(t) {
+			break
+		}
+		balance += e.Value()
+	}
+
+	return balance
+}
+
+// Summarize aggregates the entries of a currency by period. Periods without
+// entries are included so the balances form a continuous series.
+func (a *LedgerAnalytics) Summarize(currency string, period LedgerPeriod) []PeriodSummary {
+	entries := a.entries[currency]
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var summaries []PeriodSummary
+	balance := a.openingBalance(currency)
+	start := period.Start(entries[0].Timestamp)
+	last := entries[len(entries)-1].Timestamp
+	i := 0
+	for !start.After(last) {
+		end := period.Next(start)
+		s := PeriodSummary{
+			Currency:   currency,
+			Start:      start,
+			End:        end,
+			Opening:    balance,
+			ByCategory: make(map[LedgerCategory]float64),
+		}
+
+		for ; i < len(entries) && entries[i].Timestamp.Before(end); i++ {
+			v := entries[i].Value()
+			if v >= 0 {
+				s.Credits += v
+			} else {
+				s.Debits += -v
+			}
+			s.ByCategory[entries[i].Category()] += v
+			s.Entries++
+			balance += v
+		}
+		s.Closing = balance
+
+		summaries = append(summaries, s)
+		start = end
+	}
+
+	return summaries
+}
+
+// TotalsByCategory returns the sum of the entries of a currency booked
+// between start (inclusive) and end (exclusive), by category
+func (a *LedgerAnalytics) TotalsByCategory(currency string, start, end time.Time) map[LedgerCategory]float64 {
+	totals := make(map[LedgerCategory]float64)
+	for _, e := range a.entries[currency] {
+		if !e.Timestamp.Before(start) && e.Timestamp.Before(end) {
+			totals[e.Category()] += e.Value()
+		}
+	}
+
+	return totals
+}
+
+// Start returns the beginning of the period containing t, weeks start on
+// Monday. Periods are computed in UTC.
+func (p LedgerPeriod) Start(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	switch p {
+	case LedgerPeriodWeek:
+		offset := (int(t.UTC().Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+	case LedgerPeriodMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Next returns the beginning of the period following the one starting at start
+func (p LedgerPeriod) Next(start time.Time) time.Time {
+	switch p {
+	case LedgerPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case LedgerPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
+
+// ProjectSettlements returns the invoices that are confirmed but have no
+// credit among the ledger entries yet, oldest first, as they are expected to
+// settle next.
+func ProjectSettlements(invoices []Invoice, entries []LedgerEntry) []PendingSettlement {
+	credited := make(map[string]bool)
+	for _, e := range entries {
+		if e.Category() == LedgerCategoryInvoice && e.InvoiceID != "" {
+			credited[e.InvoiceID] = true
+		}
+	}
+
+	var pending []PendingSettlement
+	for _, i := range invoices {
+		if i.Status != InvoiceStatusConfirmed || credited[i.ID] {
+			continue
+		}
+		pending = append(pending, PendingSettlement{
+			InvoiceID: i.ID,
+			Status:    i.Status,
+			Currency:  i.Currency,
+			Amount:    float64(i.Price),
+			CreatedAt: i.CreatedAt(),
+		})
+	}
+
+	sort.Stable(byCreatedAt(pending))
+
+	return pending
+}
+
+// PendingTotals sums pending settlements by invoice currency
+func PendingTotals(pending []PendingSettlement) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, p := range pending {
+		totals[p.Currency] += p.Amount
+	}
+
+	return totals
+}
+
+type byTimestamp []LedgerEntry
+
+func (s byTimestamp) Len() int           { return len(s) }
+func (s byTimestamp) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTimestamp) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+
+type byCreatedAt []PendingSettlement
+
+func (s byCreatedAt) Len() int           { return len(s) }
+func (s byCreatedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCreatedAt) Less(i, j int) bool { return s[i].CreatedAt.Before(s[j].CreatedAt) }
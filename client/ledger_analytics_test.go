@@ -0,0 +1,91 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLedgerAnalytics(t *testing.T) {
+	Convey("With ledger analytics over a BTC ledger", t, func() {
+		day := func(d int) time.Time {
+			return time.Date(2015, 3, d, 12, 0, 0, 0, time.UTC)
+		}
+
+		entries := []LedgerEntry{
+			{Code: LedgerEntryPayout, Amount: -50, Scale: 100, Timestamp: day(10)},
+			{Code: LedgerEntryInvoice, Amount: 100, Scale: 100, Timestamp: day(2), InvoiceID: "a"},
+			{Code: LedgerEntryInvoiceFee, Amount: -1, Scale: 100, Timestamp: day(2), InvoiceID: "a"},
+		}
+		later := []LedgerEntry{
+			{Code: LedgerEntryInvoice, Amount: 200, Scale: 100, Timestamp: day(3), InvoiceID: "b"},
+		}
+
+		a := NewLedgerAnalytics()
+		a.Add("BTC", entries)
+		a.SetClosingBalance("BTC", 10)
+		a.Add("BTC", later)
+
+		Convey("Running balances should follow the chronological order", func() {
+			points := a.RunningBalance("BTC")
+
+			So(len(points), ShouldEqual, 4)
+			So(points[0].Entry.InvoiceID, ShouldEqual, "a")
+			So(points[0].Balance, ShouldAlmostEqual, 8.51)
+			So(points[3].Balance, ShouldAlmostEqual, 10)
+		})
+
+		Convey("The closing balance should stay anchored when entries are added", func() {
+			So(a.BalanceAt("BTC", day(31)), ShouldAlmostEqual, 10)
+
+			a.SetOpeningBalance("BTC", 1)
+
+			So(a.BalanceAt("BTC", day(31)), ShouldAlmostEqual, 3.49)
+		})
+
+		Convey("The balance at a date should include earlier entries only", func() {
+			So(a.BalanceAt("BTC", day(1)), ShouldAlmostEqual, 7.51)
+			So(a.BalanceAt("BTC", day(3)), ShouldAlmostEqual, 10.5)
+			So(a.BalanceAt("BTC", day(31)), ShouldAlmostEqual, 10)
+		})
+
+		Convey("Aggregating by week should produce continuous periods", func() {
+			weeks := a.Summarize("BTC", LedgerPeriodWeek)
+
+			So(len(weeks), ShouldEqual, 2)
+			So(weeks[0].Start, ShouldResemble, time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC))
+			So(weeks[0].Entries, ShouldEqual, 3)
+			So(weeks[0].Credits, ShouldAlmostEqual, 3)
+			So(weeks[0].Debits, ShouldAlmostEqual, 0.01)
+			So(weeks[0].ByCategory[LedgerCategoryFee], ShouldAlmostEqual, -0.01)
+			So(weeks[1].Opening, ShouldAlmostEqual, weeks[0].Closing)
+			So(weeks[1].Closing, ShouldAlmostEqual, 10)
+		})
+
+		Convey("Aggregating by day should include days without entries", func() {
+			So(len(a.Summarize("BTC", LedgerPeriodDay)), ShouldEqual, 9)
+			So(len(a.Summarize("BTC", LedgerPeriodMonth)), ShouldEqual, 1)
+		})
+
+		Convey("Totals by category should only cover the range", func() {
+			totals := a.TotalsByCategory("BTC", day(1), day(5))
+
+			So(totals[LedgerCategoryInvoice], ShouldAlmostEqual, 3)
+			So(totals[LedgerCategoryPayout], ShouldEqual, 0)
+		})
+
+		Convey("Confirmed invoices without a credit should be pending settlement", func() {
+			pending := ProjectSettlements([]Invoice{
+				{ID: "a", Price: 1, Currency: "BTC", Status: InvoiceStatusConfirmed, InvoiceTime: 2000},
+				{ID: "c", Price: 2, Currency: "USD", Status: InvoiceStatusConfirmed, InvoiceTime: 3000},
+				{ID: "d", Price: 3, Currency: "USD", Status: InvoiceStatusConfirmed, InvoiceTime: 1000},
+				{ID: "e", Price: 4, Currency: "USD", Status: InvoiceStatusNew},
+			}, append(entries, later...))
+
+			So(len(pending), ShouldEqual, 2)
+			So(pending[0].InvoiceID, ShouldEqual, "d")
+			So(PendingTotals(pending)["USD"], ShouldEqual, 5)
+		})
+	})
+}
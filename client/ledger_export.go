@@ -0,0 +1,331 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultChartOfAccounts is used by the journal exporter when no accounts
+	// are configured
+	DefaultChartOfAccounts = ChartOfAccounts{
+		Balance:  "1010",
+		Invoice:  "4000",
+		Fee:      "6100",
+		Payout:   "1000",
+		Refund:   "4100",
+		Exchange: "7900",
+		Other:    "9999",
+	}
+
+	// LedgerExportFormats lists the formats accepted by NewLedgerExporter
+	LedgerExportFormats = []string{"csv", "ofx", "qif", "journal"}
+)
+
+type (
+	// LedgerExporter writes the ledger entries of a currency in an accounting
+	// format
+	LedgerExporter interface {
+		ExportLedger(w io.Writer, currency string, entries []LedgerEntry) error
+	}
+
+	// CSVExporter writes one row per ledger entry, preceded by a header row
+	CSVExporter struct{}
+
+	// OFXExporter writes ledger entries as an OFX 1.02 bank statement
+	OFXExporter struct {
+		// AccountID is used as the statement account, defaults to BITPAY-<currency>
+		AccountID string
+	}
+
+	// QIFExporter writes ledger entries as a QIF bank account
+	QIFExporter struct{}
+
+	// JournalExporter writes ledger entries as double-entry journal rows,
+	// each entry is booked against the balance account and the account of its
+	// category. Accounts missing from Accounts are taken from
+	// DefaultChartOfAccounts.
+	JournalExporter struct {
+		Accounts ChartOfAccounts
+	}
+
+	// ChartOfAccounts maps ledger entries to the account codes of a chart of
+	// accounts
+	ChartOfAccounts struct {
+		// Balance is the asset account holding the BitPay balance
+		Balance  string `json:"balance"`
+		Invoice  string `json:"invoice"`
+		Fee      string `json:"fee"`
+		Payout   string `json:"payout"`
+		Refund   string `json:"refund"`
+		Exchange string `json:"exchange"`
+		Other    string `json:"other"`
+
+		// Codes overrides the category account for specific entry codes
+		Codes map[LedgerEntryCode]string `json:"codes,omitempty"`
+	}
+)
+
+// NewLedgerExporter returns the exporter for one of LedgerExportFormats.
+// accounts is only used by the journal format.
+func NewLedgerExporter(format string, accounts ChartOfAccounts) (LedgerExporter, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return CSVExporter{}, nil
+	case "ofx":
+		return OFXExporter{}, nil
+	case "qif":
+		return QIFExporter{}, nil
+	case "journal":
+		return JournalExporter{Accounts: accounts}, nil
+	}
+
+	return nil, fmt.Errorf("unknown ledger export format %q, expected one of %s", format, strings.Join(LedgerExportFormats, ", "))
+}
+
+// withDefaults returns the chart with the accounts it misses taken from
+// DefaultChartOfAccounts
+func (a ChartOfAccounts) withDefaults() ChartOfAccounts {
+	defaults := []struct {
+		account  *string
+		fallback string
+	}{
+		{&a.Balance, DefaultChartOfAccounts.Balance},
+		{&a.Invoice, DefaultChartOfAccounts.Invoice},
+		{&a.Fee, DefaultChartOfAccounts.Fee},
+		{&a.Payout, DefaultChartOfAccounts.Payout},
+		{&a.Refund, DefaultChartOfAccounts.Refund},
+		{&a.Exchange, DefaultChartOfAccounts.Exchange},
+		{&a.Other, DefaultChartOfAccounts.Other},
+	}
+	for _, d := range defaults {
+		if *d.account == "" {
+			*d.account = d.fallback
+		}
+	}
+
+	return a
+}
+
+// Account returns the account code the entry is booked against, besides the
+// balance account
+func (a ChartOfAccounts) Account(e LedgerEntry) string {
+	if account, ok := a.Codes[e.Code]; ok {
+		return account
+	}
+
+	var account string
+	switch e.Category() {
+	case LedgerCategoryInvoice:
+		account = a.Invoice
+	case LedgerCategoryFee:
+		account = a.Fee
+	case LedgerCategoryPayout:
+		account = a.Payout
+	case LedgerCategoryRefund:
+		account = a.Refund
+	case LedgerCategoryExchange:
+		account = a.Exchange
+	}
+	if account == "" {
+		account = a.Other
+	}
+
+	return account
+}
+
+// ExportLedger implements LedgerExporter
+func (CSVExporter) ExportLedger(w io.Writer, currency string, entries []LedgerEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "code", "category", "tx_type", "description", "invoice_id", "amount", "currency", "buyer_name", "buyer_email"})
+
+	for _, e := range entries {
+		cw.Write([]string{
+			e.Timestamp.UTC().Format(time.RFC3339),
+			strconv.Itoa(int(e.Code)),
+			string(e.Category()),
+			csvText(e.TxType),
+			csvText(e.Description),
+			csvText(e.InvoiceID),
+			e.FormatAmount(),
+			csvText(currency),
+			csvText(e.BuyerFields.BuyerName),
+			csvText(e.BuyerFields.BuyerEmail),
+		})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ExportLedger implements LedgerExporter. The ledger balance of the statement
+// is the sum of the exported entries.
+func (x OFXExporter) ExportLedger(w io.Writer, currency string, entries []LedgerEntry) error {
+	account := x.AccountID
+	if account == "" {
+		account = "BITPAY-" + currency
+	}
+
+	var start, end time.Time
+	var balance float64
+	for i, e := range entries {
+		if i == 0 || e.Timestamp.Before(start) {
+			start = e.Timestamp
+		}
+		if i == 0 || e.Timestamp.After(end) {
+			end = e.Timestamp
+		}
+		balance += e.Value()
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:USASCII\r\nCHARSET:1252\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n")
+	fmt.Fprint(bw, "<OFX>\r\n")
+	fmt.Fprintf(bw, "<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>%s<LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>\r\n", ofxTime(time.Now()))
+	fmt.Fprint(bw, "<BANKMSGSRSV1><STMTTRNRS><TRNUID>1<STATUS><CODE>0<SEVERITY>INFO</STATUS>\r\n")
+	fmt.Fprintf(bw, "<STMTRS><CURDEF>%s<BANKACCTFROM><BANKID>BITPAY<ACCTID>%s<ACCTTYPE>CHECKING</BANKACCTFROM>\r\n", ofxEscape(currency), ofxEscape(account))
+	fmt.Fprintf(bw, "<BANKTRANLIST><DTSTART>%s<DTEND>%s\r\n", ofxTime(start), ofxTime(end))
+
+	for _, e := range entries {
+		fmt.Fprintf(bw, "<STMTTRN><TRNTYPE>%s<DTPOSTED>%s<TRNAMT>%s<FITID>%s<NAME>%s",
+			ofxTransactionType(e), ofxTime(e.Timestamp), e.FormatAmount(), ledgerEntryID(e), ofxEscape(truncate(ledgerEntryPayee(e), 32)))
+		if e.InvoiceID != "" {
+			fmt.Fprintf(bw, "<MEMO>%s", ofxEscape("Invoice "+e.InvoiceID))
+		}
+		fmt.Fprint(bw, "</STMTTRN>\r\n")
+	}
+
+	fmt.Fprint(bw, "</BANKTRANLIST>\r\n")
+	fmt.Fprintf(bw, "<LEDGERBAL><BALAMT>%s<DTASOF>%s</LEDGERBAL>\r\n", strconv.FormatFloat(balance, 'f', -1, 64), ofxTime(end))
+	fmt.Fprint(bw, "</STMTRS></STMTTRNRS></BANKMSGSRSV1>\r\n</OFX>\r\n")
+
+	return bw.Flush()
+}
+
+// ExportLedger implements LedgerExporter
+func (QIFExporter) ExportLedger(w io.Writer, currency string, entries []LedgerEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "!Type:Bank\n")
+
+	for _, e := range entries {
+		fmt.Fprintf(bw, "D%s\n", e.Timestamp.UTC().Format("01/02/2006"))
+		fmt.Fprintf(bw, "T%s\n", e.FormatAmount())
+		fmt.Fprintf(bw, "P%s\n", qifEscape(ledgerEntryPayee(e)))
+		if e.Description != "" {
+			fmt.Fprintf(bw, "M%s\n", qifEscape(e.Description))
+		}
+		if e.InvoiceID != "" {
+			fmt.Fprintf(bw, "N%s\n", qifEscape(e.InvoiceID))
+		}
+		fmt.Fprintf(bw, "L%s\n", e.Category())
+		fmt.Fprint(bw, "^\n")
+	}
+
+	return bw.Flush()
+}
+
+// ExportLedger implements LedgerExporter. Credits are debited to the balance
+// account, debits are credited to it.
+func (x JournalExporter) ExportLedger(w io.Writer, currency string, entries []LedgerEntry) error {
+	accounts := x.Accounts.withDefaults()
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "reference", "account", "debit", "credit", "currency", "description"})
+
+	for _, e := range entries {
+		date := e.Timestamp.UTC().Format(ledgerDateFormat)
+		reference := ledgerEntryID(e)
+		description := e.Description
+		if e.InvoiceID != "" {
+			description = strings.TrimSpace(description + " (invoice " + e.InvoiceID + ")")
+		}
+		description = csvText(description)
+
+		amount := e.FormatAmount()
+		debit, credit := accounts.Balance, accounts.Account(e)
+		if strings.HasPrefix(amount, "-") {
+			amount = amount[1:]
+			debit, credit = credit, debit
+		}
+
+		cw.Write([]string{date, reference, csvText(debit), amount, "", csvText(currency), description})
+		cw.Write([]string{date, reference, csvText(credit), "", amount, csvText(currency), description})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ledgerEntryID derives a stable identifier for an entry, so that importing
+// overlapping exports doesn't create duplicates
+func ledgerEntryID(e LedgerEntry) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%d|%d|%d|%s|%s|%s", e.Timestamp.UnixNano(), e.Code, e.Amount, e.InvoiceID, e.TxType, e.Description)
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func ledgerEntryPayee(e LedgerEntry) string {
+	if e.BuyerFields.BuyerName != "" {
+		return e.BuyerFields.BuyerName
+	}
+	if e.Description != "" {
+		return e.Description
+	}
+
+	return string(e.Category())
+}
+
+func ofxTransactionType(e LedgerEntry) string {
+	switch e.Category() {
+	case LedgerCategoryFee:
+		return "FEE"
+	case LedgerCategoryPayout, LedgerCategoryExchange:
+		return "XFER"
+	}
+	if e.Amount < 0 {
+		return "DEBIT"
+	}
+
+	return "CREDIT"
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405")
+}
+
+var ofxReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ")
+
+func ofxEscape(s string) string {
+	return ofxReplacer.Replace(s)
+}
+
+// csvText escapes text cells starting like a formula, so spreadsheets opening
+// the export don't evaluate them
+func csvText(s string) string {
+	if s != "" && strings.ContainsAny(s[:1], "=+-@\t\r") {
+		return "'" + s
+	}
+
+	return s
+}
+
+func qifEscape(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+
+	return string(r[:n])
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testLedgerEntries() []LedgerEntry {
+	ts := time.Date(2015, 3, 14, 9, 26, 53, 0, time.UTC)
+
+	return []LedgerEntry{
+		{
+			Code:        LedgerEntryInvoice,
+			Amount:      12345,
+			Scale:       100,
+			Timestamp:   ts,
+			Description: "Invoice payment",
+			InvoiceID:   "inv1",
+			TxType:      "sale",
+			BuyerFields: LedgerBuyer{BuyerName: "Foo Bar", BuyerEmail: "foo@example.com"},
+		},
+		{
+			Code:        LedgerEntryInvoiceFee,
+			Amount:      -123,
+			Scale:       100,
+			Timestamp:   ts,
+			Description: "Invoice fee",
+			InvoiceID:   "inv1",
+		},
+	}
+}
+
+func TestLedgerEntry(t *testing.T) {
+	Convey("With a ledger entry", t, func() {
+		Convey("Amounts should be formatted according to the scale", func() {
+			So(LedgerEntry{Amount: 12345, Scale: 100}.FormatAmount(), ShouldEqual, "123.45")
+			So(LedgerEntry{Amount: -5, Scale: 100000000}.FormatAmount(), ShouldEqual, "-0.00000005")
+			So(LedgerEntry{Amount: 42}.FormatAmount(), ShouldEqual, "42")
+			So(LedgerEntry{Amount: 3, Scale: 4}.FormatAmount(), ShouldEqual, "0.75")
+			So(LedgerEntry{Amount: math.MinInt64, Scale: 100}.FormatAmount(), ShouldEqual, "-92233720368547758.08")
+		})
+
+		Convey("Unknown codes should be classified by their txType", func() {
+			So(LedgerEntry{Code: LedgerEntryInvoiceFee}.Category(), ShouldEqual, LedgerCategoryFee)
+			So(LedgerEntry{Code: 9999, TxType: "Refund"}.Category(), ShouldEqual, LedgerCategoryRefund)
+			So(LedgerEntry{Code: 9999}.Category(), ShouldEqual, LedgerCategoryOther)
+		})
+	})
+}
+
+func TestLedgerExport(t *testing.T) {
+	Convey("Exporting ledger entries", t, func() {
+		entries := testLedgerEntries()
+		var buf bytes.Buffer
+
+		Convey("As CSV should write a row per entry", func() {
+			So(CSVExporter{}.ExportLedger(&buf, "USD", entries), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(lines[1], ShouldEqual, "2015-03-14T09:26:53Z,1000,invoice,sale,Invoice payment,inv1,123.45,USD,Foo Bar,foo@example.com")
+		})
+
+		Convey("As OFX should write a transaction per entry", func() {
+			So(OFXExporter{}.ExportLedger(&buf, "USD", entries), ShouldBeNil)
+
+			So(strings.Count(buf.String(), "<STMTTRN>"), ShouldEqual, 2)
+			So(buf.String(), ShouldContainSubstring, "<TRNTYPE>CREDIT<DTPOSTED>20150314092653<TRNAMT>123.45")
+			So(buf.String(), ShouldContainSubstring, "<TRNTYPE>FEE")
+			So(buf.String(), ShouldContainSubstring, "<ACCTID>BITPAY-USD")
+			So(buf.String(), ShouldContainSubstring, "<BALAMT>122.22")
+		})
+
+		Convey("As QIF should write a record per entry", func() {
+			So(QIFExporter{}.ExportLedger(&buf, "USD", entries), ShouldBeNil)
+
+			So(buf.String(), ShouldStartWith, "!Type:Bank\n")
+			So(strings.Count(buf.String(), "^\n"), ShouldEqual, 2)
+			So(buf.String(), ShouldContainSubstring, "D03/14/2015\nT-1.23\nPInvoice fee\n")
+		})
+
+		Convey("As a journal should balance every entry", func() {
+			accounts := DefaultChartOfAccounts
+			accounts.Codes = map[LedgerEntryCode]string{LedgerEntryInvoiceFee: "6200"}
+
+			So(JournalExporter{Accounts: accounts}.ExportLedger(&buf, "USD", entries), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(len(lines), ShouldEqual, 5)
+			So(lines[1], ShouldEndWith, ",1010,123.45,,USD,Invoice payment (invoice inv1)")
+			So(lines[2], ShouldEndWith, ",4000,,123.45,USD,Invoice payment (invoice inv1)")
+			So(lines[3], ShouldEndWith, ",6200,1.23,,USD,Invoice fee (invoice inv1)")
+			So(lines[4], ShouldEndWith, ",1010,,1.23,USD,Invoice fee (invoice inv1)")
+		})
+
+		Convey("As a journal should default each missing account", func() {
+			accounts := ChartOfAccounts{Invoice: "4010"}
+
+			So(JournalExporter{Accounts: accounts}.ExportLedger(&buf, "USD", entries[:1]), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(lines[1], ShouldContainSubstring, ",1010,123.45,")
+			So(lines[2], ShouldContainSubstring, ",4010,,123.45,")
+		})
+
+		Convey("As CSV should escape cells starting like a formula", func() {
+			entries[0].Description = "=HYPERLINK(\"http://example.com\")"
+			entries[0].BuyerFields.BuyerName = "@SUM(A1)"
+
+			So(CSVExporter{}.ExportLedger(&buf, "USD", entries), ShouldBeNil)
+
+			So(buf.String(), ShouldContainSubstring, `,"'=HYPERLINK(""http://example.com"")",`)
+			So(buf.String(), ShouldContainSubstring, ",'@SUM(A1),")
+			So(buf.String(), ShouldContainSubstring, ",-1.23,")
+		})
+
+		Convey("In an unknown format should fail", func() {
+			_, err := NewLedgerExporter("xls", DefaultChartOfAccounts)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
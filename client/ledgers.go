@@ -1,3 +1,205 @@
 package client
 
 // https://test.bitpay.com/api#resource-Ledgers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LedgerPageDays is the maximum number of days requested from the ledgers
+	// endpoint in a single call, longer ranges are fetched page by page.
+	LedgerPageDays = 31
+
+	ledgerDateFormat = "2006-01-02"
+)
+
+var (
+	LedgerEntryInvoice    LedgerEntryCode = 1000
+	LedgerEntryRefund     LedgerEntryCode = 1001
+	LedgerEntryExchange   LedgerEntryCode = 1011
+	LedgerEntryPayout     LedgerEntryCode = 1020
+	LedgerEntryInvoiceFee LedgerEntryCode = 1023
+
+	LedgerCategoryInvoice  LedgerCategory = "invoice"
+	LedgerCategoryFee      LedgerCategory = "fee"
+	LedgerCategoryPayout   LedgerCategory = "payout"
+	LedgerCategoryRefund   LedgerCategory = "refund"
+	LedgerCategoryExchange LedgerCategory = "exchange"
+	LedgerCategoryOther    LedgerCategory = "other"
+)
+
+type (
+	// Ledger maps to a resource at the ledgers endpoint
+	Ledger struct {
+		Currency string  `json:"currency"`
+		Balance  float64 `json:"balance"`
+	}
+
+	// LedgerEntryCode identifies the kind of transaction a ledger entry records
+	LedgerEntryCode int
+
+	// LedgerCategory groups ledger entry codes by their accounting meaning
+	LedgerCategory string
+
+	// LedgerEntry maps to an entry returned by the ledger of a currency
+	LedgerEntry struct {
+		Code        LedgerEntryCode `json:"code"`
+		Amount      int64           `json:"amount"`
+		Scale       int64           `json:"scale"`
+		Timestamp   time.Time       `json:"timestamp"`
+		Description string          `json:"description"`
+		InvoiceID   string          `json:"invoiceId,omitempty"`
+		TxType      string          `json:"txType,omitempty"`
+		BuyerFields LedgerBuyer     `json:"buyerFields"`
+
+		// Price and currency of the invoice the entry relates to
+		InvoiceAmount   float64 `json:"invoiceAmount,omitempty"`
+		InvoiceCurrency string  `json:"invoiceCurrency,omitempty"`
+	}
+
+	// LedgerBuyer maps to the buyerFields object in a LedgerEntry
+	LedgerBuyer struct {
+		BuyerName     string `json:"buyerName,omitempty"`
+		BuyerAddress1 string `json:"buyerAddress1,omitempty"`
+		BuyerAddress2 string `json:"buyerAddress2,omitempty"`
+		BuyerCity     string `json:"buyerCity,omitempty"`
+		BuyerState    string `json:"buyerState,omitempty"`
+		BuyerZip      string `json:"buyerZip,omitempty"`
+		BuyerCountry  string `json:"buyerCountry,omitempty"`
+		BuyerEmail    string `json:"buyerEmail,omitempty"`
+		BuyerPhone    string `json:"buyerPhone,omitempty"`
+	}
+)
+
+// Category returns the accounting category of the entry. Unknown codes are
+// classified by their txType.
+func (e LedgerEntry) Category() LedgerCategory {
+	switch e.Code {
+	case LedgerEntryInvoice:
+		return LedgerCategoryInvoice
+	case LedgerEntryInvoiceFee:
+		return LedgerCategoryFee
+	case LedgerEntryPayout:
+		return LedgerCategoryPayout
+	case LedgerEntryRefund:
+		return LedgerCategoryRefund
+	case LedgerEntryExchange:
+		return LedgerCategoryExchange
+	}
+
+	switch strings.ToLower(e.TxType) {
+	case "sale", "invoice":
+		return LedgerCategoryInvoice
+	case "fee":
+		return LedgerCategoryFee
+	case "payout", "settlement":
+		return LedgerCategoryPayout
+	case "refund":
+		return LedgerCategoryRefund
+	case "exchange":
+		return LedgerCategoryExchange
+	}
+
+	return LedgerCategoryOther
+}
+
+// Value returns the amount of the entry in units of the ledger currency
+func (e LedgerEntry) Value() float64 {
+	if e.Scale == 0 {
+		return float64(e.Amount)
+	}
+
+	return float64(e.Amount) / float64(e.Scale)
+}
+
+// FormatAmount returns the amount of the entry as a decimal string in units
+// of the ledger currency, without going through floating point when the
+// scale is a power of ten.
+func (e LedgerEntry) FormatAmount() string {
+	digits := 0
+	for s := e.Scale; s > 1; s /= 10 {
+		if s%10 != 0 {
+			return strconv.FormatFloat(e.Value(), 'f', -1, 64)
+		}
+		digits++
+	}
+
+	// Negate in unsigned arithmetic, -math.MinInt64 overflows an int64
+	amount := uint64(e.Amount)
+	sign := ""
+	if e.Amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := strconv.FormatUint(amount, 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// QueryLedgers returns the ledger currencies of the calling merchant along
+// with their balances.
+func (c *Client) QueryLedgers() ([]Ledger, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/ledgers", c.apiBase), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ledgers []Ledger
+	resp, err := c.Send(req, &ledgers)
+
+	return ledgers, resp, err
+}
+
+// GetLedger returns the ledger entries of a currency between startDate and
+// endDate, both inclusive. Ranges longer than LedgerPageDays are split into
+// several requests. Only the response of the last request is returned, or
+// the one of the request which failed.
+func (c *Client) GetLedger(currency string, startDate, endDate time.Time) ([]LedgerEntry, *http.Response, error) {
+	var entries []LedgerEntry
+	var resp *http.Response
+
+	start := startDate.UTC().Truncate(24 * time.Hour)
+	end := endDate.UTC().Truncate(24 * time.Hour)
+	for !start.After(end) {
+		pageEnd := start.AddDate(0, 0, LedgerPageDays-1)
+		if pageEnd.After(end) {
+			pageEnd = end
+		}
+
+		page, r, err := c.getLedgerPage(currency, start, pageEnd)
+		resp = r
+		if err != nil {
+			return entries, resp, err
+		}
+		entries = append(entries, page...)
+
+		start = pageEnd.AddDate(0, 0, 1)
+	}
+
+	return entries, resp, nil
+}
+
+func (c *Client) getLedgerPage(currency string, startDate, endDate time.Time) ([]LedgerEntry, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/ledgers/%s?startDate=%s&endDate=%s",
+		c.apiBase, currency, startDate.Format(ledgerDateFormat), endDate.Format(ledgerDateFormat)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []LedgerEntry
+	resp, err := c.Send(req, &entries)
+
+	return entries, resp, err
+}
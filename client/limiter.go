@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThrottlePause is how long a group of endpoints is paused after the
+// API throttled a call without telling when to retry, unless set by its
+// RateLimit
+const DefaultThrottlePause = time.Second
+
+type (
+	// RateLimit limits the calls to a group of endpoints
+	RateLimit struct {
+		// Rate is the number of calls per second, 0 for no limit
+		Rate float64
+
+		// Burst is the number of calls that can be made at once after a
+		// pause, 1 if not set
+		Burst int
+
+		// MaxInFlight is the number of calls that can be in flight at once,
+		// 0 for no limit
+		MaxInFlight int
+
+		// ThrottlePause is how long the group is paused after the API
+		// throttled a call without telling when to retry,
+		// DefaultThrottlePause if not set
+		ThrottlePause time.Duration
+	}
+
+	// limiter is a token bucket and a semaphore limiting the calls to a
+	// group of endpoints. Its rate is halved when the API throttles a call,
+	// and recovers gradually as calls succeed.
+	limiter struct {
+		sync.Mutex
+		limit    RateLimit
+		rate     float64
+		tokens   float64
+		last     time.Time
+		paused   time.Time
+		inFlight chan struct{}
+
+		// now returns the current time, it is replaced in tests
+		now func() time.Time
+	}
+)
+
+// WithRateLimit limits the calls to a group of endpoints, named after the
+// first segment of their path, e.g. "invoices" or "rates". The empty group
+// limits the calls to the endpoints without a limit of their own. Calls
+// over the limit wait for their turn, or for their context to be done.
+func WithRateLimit(group string, limit RateLimit) Option {
+	return func(c *Client) error {
+		if limit.Rate < 0 || limit.Burst < 0 || limit.MaxInFlight < 0 || limit.ThrottlePause < 0 {
+			return errors.New("rate limits can't be negative")
+		}
+		if limit.Burst == 0 {
+			limit.Burst = 1
+		}
+		if limit.ThrottlePause == 0 {
+			limit.ThrottlePause = DefaultThrottlePause
+		}
+
+		l := &limiter{limit: limit, rate: limit.Rate, tokens: float64(limit.Burst), last: time.Now(), now: time.Now}
+		if limit.MaxInFlight > 0 {
+			l.inFlight = make(chan struct{}, limit.MaxInFlight)
+		}
+
+		if c.limiters == nil {
+			c.limiters = make(map[string]*limiter)
+		}
+		c.limiters[strings.Trim(group, "/")] = l
+
+		return nil
+	}
+}
+
+// limiter returns the limiter of the group of the endpoint of a request, if
+// any
+func (c *Client) limiter(req *http.Request) *limiter {
+	if len(c.limiters) == 0 {
+		return nil
+	}
+
+	group := strings.SplitN(strings.Trim(c.routePath(req.URL), "/"), "/", 2)[0]
+	if l, ok := c.limiters[group]; ok {
+		return l
+	}
+
+	return c.limiters[""]
+}
+
+// acquire waits for a call to be allowed, until ctx is done
+func (l *limiter) acquire(ctx context.Context) error {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.release()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token from the bucket, or returns how long to wait for one
+func (l *limiter) reserve() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+	if l.limit.Rate == 0 {
+		return 0
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > float64(l.limit.Burst) {
+		l.tokens = float64(l.limit.Burst)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// release frees the slot of a call in flight
+func (l *limiter) release() {
+	if l.inFlight != nil {
+		<-l.inFlight
+	}
+}
+
+// done releases the slot of a call, and adapts the rate to its response
+func (l *limiter) done(resp *http.Response) {
+	l.release()
+	if resp == nil {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		// Recover a tenth of the configured rate per successful call
+		if l.rate < l.limit.Rate {
+			l.rate += l.limit.Rate / 10
+			if l.rate > l.limit.Rate {
+				l.rate = l.limit.Rate
+			}
+		}
+		return
+	}
+
+	pause, ok := retryAfter(resp)
+	if !ok {
+		pause = l.limit.ThrottlePause
+	}
+	if until := l.now().Add(pause); until.After(l.paused) {
+		l.paused = until
+	}
+	l.last = l.paused
+
+	// Halve the rate, down to a hundredth of the configured rate
+	if l.limit.Rate > 0 && l.rate/2 >= l.limit.Rate/100 {
+		l.rate /= 2
+	}
+	l.tokens = 0
+}
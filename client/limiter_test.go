@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimits(t *testing.T) {
+	Convey("With a client limiting its calls", t, func() {
+		var mu sync.Mutex
+		inFlight, maxInFlight, throttle := 0, 0, 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			throttled := throttle > 0
+			if throttled {
+				throttle--
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+
+			if throttled {
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error":"Rate limit exceeded"}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"id":"invoice-id"}}`))
+		}))
+		defer server.Close()
+
+		bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"),
+			WithRateLimit("invoices", RateLimit{Rate: 20, MaxInFlight: 2}),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+		So(err, ShouldBeNil)
+
+		Convey("Calls should wait for the rate", func() {
+			l := bitpay.limiters["invoices"]
+			now := time.Now()
+			l.now = func() time.Time { return now }
+			l.last = now
+
+			So(l.reserve(), ShouldEqual, 0)
+			So(l.reserve(), ShouldEqual, 50*time.Millisecond)
+
+			now = now.Add(60 * time.Millisecond)
+			So(l.reserve(), ShouldEqual, 0)
+		})
+
+		Convey("Calls in flight should be limited", func() {
+			bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"),
+				WithRateLimit("", RateLimit{MaxInFlight: 2}))
+			So(err, ShouldBeNil)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 6; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					bitpay.GetInvoice("invoice-id")
+				}()
+			}
+			wg.Wait()
+
+			So(maxInFlight, ShouldEqual, 2)
+		})
+
+		Convey("Other groups of endpoints should not be limited", func() {
+			req, err := http.NewRequest("GET", server.URL+"/rates", nil)
+			So(err, ShouldBeNil)
+			So(bitpay.limiter(req), ShouldBeNil)
+
+			req, err = http.NewRequest("GET", server.URL+"/invoices/invoice-id", nil)
+			So(err, ShouldBeNil)
+			So(bitpay.limiter(req), ShouldEqual, bitpay.limiters["invoices"])
+		})
+
+		Convey("Waiting calls should stop with their context", func() {
+			slow, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"),
+				WithRateLimit("invoices", RateLimit{Rate: 0.1}))
+			So(err, ShouldBeNil)
+			_, _, err = slow.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, _, err = slow.WithContext(ctx).GetInvoice("invoice-id")
+
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+		})
+
+		Convey("Throttled calls should pause the group and slow it down", func() {
+			l := bitpay.limiters["invoices"]
+			now := time.Now()
+			l.now = func() time.Time { return now }
+
+			throttle = 1
+			_, _, err := bitpay.GetInvoice("invoice-id")
+			So(err, ShouldNotBeNil)
+			So(l.rate, ShouldEqual, 10)
+			So(l.reserve(), ShouldEqual, DefaultThrottlePause)
+
+			now = now.Add(DefaultThrottlePause)
+			So(l.reserve(), ShouldEqual, 100*time.Millisecond)
+
+			now = now.Add(200 * time.Millisecond)
+			_, _, err = bitpay.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+			So(l.rate, ShouldEqual, 12)
+		})
+
+		Convey("Throttled calls should pause the group as long as configured", func() {
+			bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"),
+				WithRateLimit("invoices", RateLimit{Rate: 20, ThrottlePause: time.Minute}),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+			So(err, ShouldBeNil)
+			l := bitpay.limiters["invoices"]
+			now := time.Now()
+			l.now = func() time.Time { return now }
+
+			throttle = 1
+			_, _, err = bitpay.GetInvoice("invoice-id")
+			So(err, ShouldNotBeNil)
+			So(l.reserve(), ShouldEqual, time.Minute)
+		})
+
+		Convey("Negative limits should be rejected", func() {
+			_, err := New(WithRateLimit("invoices", RateLimit{Rate: -1}))
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
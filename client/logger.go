@@ -0,0 +1,324 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces secrets and personal data in logs
+const redacted = "[REDACTED]"
+
+const (
+	// LevelDebug logs calls along with their headers and bodies
+	LevelDebug LogLevel = iota
+
+	// LevelInfo logs events such as session renewals
+	LevelInfo
+
+	// LevelWarn logs calls rejected by the API
+	LevelWarn
+
+	// LevelError logs calls that failed to be sent
+	LevelError
+)
+
+var (
+	// RedactedLogFields are redacted wherever they appear in logged fields,
+	// headers, queries and JSON bodies
+	RedactedLogFields = []string{
+		"token", "pairingCode", "privateKey", "private_key", "key", "passphrase",
+		"X-Signature", "Authorization", "Cookie", "Set-Cookie",
+		"public", "pos", "merchant", "payroll", "sessionId",
+		"buyer", "buyerFields", "notificationEmail", "email", "phone",
+		"name", "firstName", "lastName", "address1", "address2", "city", "state", "zip", "country",
+	}
+)
+
+type (
+	// LogLevel is the severity of a log entry
+	LogLevel int
+
+	// Field is a named value attached to a log entry, such as the method,
+	// endpoint, status, duration or guid of a call
+	Field struct {
+		Key   string
+		Value interface{}
+	}
+
+	// Logger logs structured entries. Implement it to plug the client into a
+	// logging library. Fields are redacted before they reach the logger.
+	Logger interface {
+		Log(level LogLevel, msg string, fields ...Field)
+	}
+
+	// LoggerFunc adapts a function to the Logger interface
+	LoggerFunc func(level LogLevel, msg string, fields ...Field)
+
+	// textLogger logs entries as key=value lines
+	textLogger struct {
+		sync.Mutex
+		w     io.Writer
+		level LogLevel
+	}
+)
+
+// String returns the name of the level
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+
+	return strconv.Itoa(int(l))
+}
+
+// Log calls f
+func (f LoggerFunc) Log(level LogLevel, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+// NewTextLogger returns a logger writing the entries of level or above to w,
+// one line of key=value pairs per entry
+func NewTextLogger(w io.Writer, level LogLevel) Logger {
+	return &textLogger{w: w, level: level}
+}
+
+func (l *textLogger) Log(level LogLevel, msg string, fields ...Field) {
+	if level < l.level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("time=" + time.Now().UTC().Format(time.RFC3339))
+	b.WriteString(" level=" + level.String())
+	b.WriteString(" msg=" + logValue(msg))
+	for _, f := range fields {
+		b.WriteString(" " + f.Key + "=" + logValue(fmt.Sprint(f.Value)))
+	}
+	b.WriteString("\n")
+
+	l.Lock()
+	defer l.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logValue quotes values which wouldn't read as a single value
+func logValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// envLogger returns the logger of clients created without one, logging to
+// stderr when BITPAY_DEBUG is set to a true value
+func envLogger() Logger {
+	if debug, _ := strconv.ParseBool(os.Getenv("BITPAY_DEBUG")); debug {
+		return NewTextLogger(os.Stderr, LevelDebug)
+	}
+
+	return nil
+}
+
+// log redacts the fields and logs them to the logger of the client, if any
+func (c *Client) log(level LogLevel, msg string, fields ...Field) {
+	if c.logger == nil {
+		return
+	}
+
+	for i, f := range fields {
+		fields[i] = redactField(f)
+	}
+
+	c.logger.Log(level, msg, fields...)
+}
+
+// logCall logs a call once it is sent. Failed calls are logged as errors,
+// rejected calls as warnings, the others and their bodies for debugging.
+func (c *Client) logCall(req *http.Request, resp *http.Response, data []byte, err error, duration time.Duration) {
+	if c.logger == nil {
+		return
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(r)
+			r.Close()
+		}
+	}
+
+	fields := []Field{
+		{"method", req.Method},
+		{"endpoint", c.endpoint(req)},
+	}
+	if guid := requestGUID(req, body); guid != "" {
+		fields = append(fields, Field{"guid", guid})
+	}
+
+	if err != nil {
+		c.log(LevelError, "call failed", append(fields, Field{"duration", duration}, Field{"error", c.redactError(req, err)})...)
+		return
+	}
+
+	fields = append(fields, Field{"status", resp.StatusCode}, Field{"duration", duration})
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		c.log(LevelWarn, "call rejected", fields...)
+	} else {
+		c.log(LevelDebug, "call", fields...)
+	}
+
+	c.log(LevelDebug, "call details", append(fields[:2:2],
+		Field{"query", req.URL.RawQuery},
+		Field{"requestHeaders", req.Header},
+		Field{"requestBody", string(body)},
+		Field{"responseHeaders", resp.Header},
+		Field{"responseBody", string(data)},
+	)...)
+}
+
+// requestGUID returns the guid sent along with a request, if any
+func requestGUID(req *http.Request, body []byte) string {
+	if ar, ok := req.Context().Value(authRequestKey{}).(*authRequest); ok {
+		guid, _ := ar.body["guid"].(string)
+		return guid
+	}
+
+	var fields struct {
+		GUID string `json:"guid"`
+	}
+	json.Unmarshal(body, &fields)
+
+	return fields.GUID
+}
+
+// redactField redacts sensitive fields, and sensitive values within headers,
+// queries and JSON bodies
+func redactField(f Field) Field {
+	if isRedacted(f.Key) {
+		f.Value = redacted
+		return f
+	}
+
+	switch v := f.Value.(type) {
+	case http.Header:
+		h := make(http.Header, len(v))
+		for k, values := range v {
+			if isRedacted(k) {
+				values = []string{redacted}
+			}
+			h[k] = values
+		}
+		keys := make([]string, 0, len(h))
+		for k := range h {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + ": " + strings.Join(h[k], ", ")
+		}
+		f.Value = strings.Join(pairs, "; ")
+	case string:
+		f.Value = redactString(v)
+	}
+
+	return f
+}
+
+// redactString redacts JSON documents and queries
+func redactString(s string) string {
+	var v interface{}
+	if (strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")) && json.Unmarshal([]byte(s), &v) == nil {
+		b, err := json.Marshal(redactJSON(v))
+		if err == nil {
+			return string(b)
+		}
+	}
+
+	if strings.Contains(s, "=") && !strings.ContainsAny(s, " {") {
+		if values, err := url.ParseQuery(s); err == nil {
+			return redactQuery(values)
+		}
+	}
+
+	return s
+}
+
+func redactQuery(values url.Values) string {
+	for k := range values {
+		if isRedacted(k) {
+			values.Set(k, redacted)
+		}
+	}
+
+	return values.Encode()
+}
+
+// redactError redacts the URL of transport errors, whose query holds the
+// token of GET calls and whose path holds the token of token resources. The
+// path is replaced by the endpoint of the request.
+func (c *Client) redactError(req *http.Request, err error) string {
+	msg := err.Error()
+
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return msg
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return strings.Replace(msg, urlErr.URL, redacted, -1)
+	}
+	u.RawQuery = redactQuery(u.Query())
+	u.Path = strings.TrimSuffix(u.Path, c.routePath(u)) + c.endpoint(req)
+	u.RawPath = ""
+
+	return strings.Replace(msg, urlErr.URL, u.String(), -1)
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if isRedacted(k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactJSON(e)
+		}
+	}
+
+	return v
+}
+
+func isRedacted(key string) bool {
+	for _, k := range RedactedLogFields {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogger(t *testing.T) {
+	Convey("With a client logging its calls", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"Invoice not found"}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"id":"invoice-id","buyer":{"email":"satoshi@example.com"}}}`))
+		}))
+		defer server.Close()
+
+		var logs bytes.Buffer
+		bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("secret-token"),
+			WithLogger(NewTextLogger(&logs, LevelDebug)), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+		So(err, ShouldBeNil)
+
+		Convey("Calls should be logged with their fields", func() {
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			So(logs.String(), ShouldContainSubstring, "level=debug msg=call method=POST endpoint=/invoices guid=")
+			So(logs.String(), ShouldContainSubstring, "status=200 duration=")
+		})
+
+		Convey("Tokens, signatures and buyer details should be redacted", func() {
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD", Buyer: Buyer{Email: "satoshi@example.com"}})
+			So(err, ShouldBeNil)
+			_, _, err = bitpay.GetInvoice("invoice-id")
+			So(err, ShouldNotBeNil)
+
+			So(logs.String(), ShouldNotContainSubstring, "secret-token")
+			So(logs.String(), ShouldNotContainSubstring, "satoshi@example.com")
+			So(logs.String(), ShouldContainSubstring, "X-Signature: [REDACTED]")
+			So(logs.String(), ShouldContainSubstring, "level=warn msg=\"call rejected\" method=GET endpoint=/invoices/:id status=404")
+		})
+
+		Convey("Tokens should be redacted from the URLs of failed calls", func() {
+			server.Close()
+
+			_, _, err := bitpay.GetInvoice("invoice-id")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "secret-token")
+
+			So(logs.String(), ShouldContainSubstring, "level=error msg=\"call failed\"")
+			So(logs.String(), ShouldContainSubstring, "token=%5BREDACTED%5D")
+			So(logs.String(), ShouldNotContainSubstring, "secret-token")
+		})
+
+		Convey("Tokens should be redacted from the paths of token resources", func() {
+			_, _, err := bitpay.GetToken("secret-path-token")
+			So(err, ShouldNotBeNil)
+			So(logs.String(), ShouldContainSubstring, "method=GET endpoint=/tokens/:token status=404")
+
+			server.Close()
+			_, _, err = bitpay.GetToken("secret-path-token")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "secret-path-token")
+
+			So(logs.String(), ShouldContainSubstring, "/tokens/:token?token=%5BREDACTED%5D")
+			So(logs.String(), ShouldNotContainSubstring, "secret-path-token")
+		})
+
+		Convey("Bill contact details should be redacted", func() {
+			_, err := bitpay.CreateBill(Bill{Currency: "USD", Name: "Satoshi Nakamoto", Address1: "1 Main Street", City: "Springfield", Zip: "12345"})
+			So(err, ShouldBeNil)
+
+			for _, detail := range []string{"Satoshi Nakamoto", "1 Main Street", "Springfield", "12345"} {
+				So(logs.String(), ShouldNotContainSubstring, detail)
+			}
+		})
+
+		Convey("Entries below the level of the logger should be skipped", func() {
+			var warnings bytes.Buffer
+			bitpay.logger = NewTextLogger(&warnings, LevelWarn)
+
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			So(warnings.String(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,299 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency
+// histogram buckets of NewMetrics
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+const (
+	// ErrorClassNone is the class of calls that didn't fail
+	ErrorClassNone ErrorClass = iota
+
+	// ErrorClassNetwork is the class of calls that couldn't be sent or whose
+	// response couldn't be read
+	ErrorClassNetwork
+
+	// ErrorClassTimeout is the class of calls that timed out
+	ErrorClassTimeout
+
+	// ErrorClassCanceled is the class of calls whose context was canceled
+	ErrorClassCanceled
+
+	// ErrorClassRateLimited is the class of calls throttled by the API
+	ErrorClassRateLimited
+
+	// ErrorClassClient is the class of calls rejected with a 4xx status
+	ErrorClassClient
+
+	// ErrorClassServer is the class of calls failed with a 5xx status
+	ErrorClassServer
+
+	// ErrorClassAPI is the class of calls answered with an error in their
+	// body
+	ErrorClassAPI
+)
+
+type (
+	// ErrorClass groups the errors of the calls in metrics
+	ErrorClass int
+
+	// Metrics collects the number, latency and errors of the calls of the
+	// clients it is added to with WithMetrics, labelled by endpoint, method,
+	// status and error class. It serves them in the Prometheus text format.
+	Metrics struct {
+		mu       sync.Mutex
+		buckets  []float64
+		requests map[requestLabels]uint64
+		errors   map[errorLabels]uint64
+		latency  map[latencyLabels]*histogram
+	}
+
+	requestLabels struct {
+		endpoint, method, status string
+	}
+
+	errorLabels struct {
+		endpoint, method string
+		class            ErrorClass
+	}
+
+	latencyLabels struct {
+		endpoint, method string
+	}
+
+	histogram struct {
+		counts []uint64
+		sum    float64
+		count  uint64
+	}
+)
+
+// NewMetrics returns a collector with the given latency buckets, in seconds,
+// or DefaultLatencyBuckets
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		buckets:  buckets,
+		requests: make(map[requestLabels]uint64),
+		errors:   make(map[errorLabels]uint64),
+		latency:  make(map[latencyLabels]*histogram),
+	}
+}
+
+// WithMetrics records the calls of the client in m. A collector can be shared
+// by several clients.
+func WithMetrics(m *Metrics) Option {
+	return func(c *Client) error {
+		c.Use(m.middleware(c))
+
+		return nil
+	}
+}
+
+// middleware records the calls of c, retries included
+func (m *Metrics) middleware(c *Client) Middleware {
+	return func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, []byte, error) {
+			start := time.Now()
+			resp, data, err := next(req)
+			m.observe(c.endpoint(req), req.Method, resp, data, err, time.Since(start))
+
+			return resp, data, err
+		}
+	}
+}
+
+func (m *Metrics) observe(endpoint, method string, resp *http.Response, data []byte, err error, duration time.Duration) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	class := classifyError(resp, data, err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{endpoint, method, status}]++
+	if class != ErrorClassNone {
+		m.errors[errorLabels{endpoint, method, class}]++
+	}
+
+	h, ok := m.latency[latencyLabels{endpoint, method}]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[latencyLabels{endpoint, method}] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// classifyError returns the class of the error of a call, if it failed
+func classifyError(resp *http.Response, data []byte, err error) ErrorClass {
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		if err == context.Canceled {
+			return ErrorClassCanceled
+		}
+		if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || err == context.DeadlineExceeded {
+			return ErrorClassTimeout
+		}
+
+		return ErrorClassNetwork
+	}
+
+	switch code := resp.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return ErrorClassRateLimited
+	case code >= 500:
+		return ErrorClassServer
+	case code < 200 || code > 299:
+		return ErrorClassClient
+	}
+
+	r := Response{}
+	if json.Unmarshal(data, &r) == nil && r.Error != "" {
+		return ErrorClassAPI
+	}
+
+	return ErrorClassNone
+}
+
+// String returns the name of the class, as used in metrics labels
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassNone:
+		return "none"
+	case ErrorClassNetwork:
+		return "network"
+	case ErrorClassTimeout:
+		return "timeout"
+	case ErrorClassCanceled:
+		return "canceled"
+	case ErrorClassRateLimited:
+		return "rate_limited"
+	case ErrorClassClient:
+		return "client"
+	case ErrorClassServer:
+		return "server"
+	case ErrorClassAPI:
+		return "api"
+	}
+
+	return strconv.Itoa(int(c))
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var lines []string
+
+	lines = append(lines,
+		"# HELP bitpay_client_requests_total Number of calls to the BitPay API.",
+		"# TYPE bitpay_client_requests_total counter")
+	var requests []string
+	for l, n := range m.requests {
+		requests = append(requests, fmt.Sprintf("bitpay_client_requests_total{%s} %d",
+			labels("endpoint", l.endpoint, "method", l.method, "status", l.status), n))
+	}
+	sort.Strings(requests)
+	lines = append(lines, requests...)
+
+	lines = append(lines,
+		"# HELP bitpay_client_errors_total Number of failed calls to the BitPay API.",
+		"# TYPE bitpay_client_errors_total counter")
+	var failures []string
+	for l, n := range m.errors {
+		failures = append(failures, fmt.Sprintf("bitpay_client_errors_total{%s} %d",
+			labels("endpoint", l.endpoint, "method", l.method, "class", l.class.String()), n))
+	}
+	sort.Strings(failures)
+	lines = append(lines, failures...)
+
+	lines = append(lines,
+		"# HELP bitpay_client_request_duration_seconds Latency of the calls to the BitPay API, retries included.",
+		"# TYPE bitpay_client_request_duration_seconds histogram")
+	keys := make([]latencyLabels, 0, len(m.latency))
+	for l := range m.latency {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].method < keys[j].method
+	})
+	for _, l := range keys {
+		h := m.latency[l]
+		for i, bound := range m.buckets {
+			lines = append(lines, fmt.Sprintf("bitpay_client_request_duration_seconds_bucket{%s} %d",
+				labels("endpoint", l.endpoint, "method", l.method, "le", strconv.FormatFloat(bound, 'g', -1, 64)), h.counts[i]))
+		}
+		lines = append(lines,
+			fmt.Sprintf("bitpay_client_request_duration_seconds_bucket{%s} %d",
+				labels("endpoint", l.endpoint, "method", l.method, "le", "+Inf"), h.count),
+			fmt.Sprintf("bitpay_client_request_duration_seconds_sum{%s} %s",
+				labels("endpoint", l.endpoint, "method", l.method), strconv.FormatFloat(h.sum, 'g', -1, 64)),
+			fmt.Sprintf("bitpay_client_request_duration_seconds_count{%s} %d",
+				labels("endpoint", l.endpoint, "method", l.method), h.count))
+	}
+
+	bw := bufio.NewWriter(w)
+	var n int64
+	for _, line := range lines {
+		written, err := bw.WriteString(line + "\n")
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, bw.Flush()
+}
+
+// labels formats label pairs, escaping their values
+func labels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	formatted := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		formatted = append(formatted, pairs[i]+`="`+escaper.Replace(pairs[i+1])+`"`)
+	}
+
+	return strings.Join(formatted, ",")
+}
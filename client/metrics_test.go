@@ -0,0 +1,61 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("With a client recording metrics", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/invoices/missing":
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"Invoice not found"}`))
+			case "/rates/USD":
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error":"Rate limit exceeded"}`))
+			default:
+				w.Write([]byte(`{"data":{"id":"invoice-id"}}`))
+			}
+		}))
+		defer server.Close()
+
+		metrics := NewMetrics(0.5, 0.1)
+		bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"),
+			WithMetrics(metrics), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+		So(err, ShouldBeNil)
+
+		bitpay.GetInvoice("invoice-id")
+		bitpay.GetInvoice("other-id")
+		bitpay.GetInvoice("missing")
+		bitpay.GetRateForCurrency("USD")
+
+		recorder := httptest.NewRecorder()
+		metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		body := recorder.Body.String()
+
+		Convey("Calls should be counted by endpoint pattern, method and status", func() {
+			So(recorder.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+			So(body, ShouldContainSubstring, "# TYPE bitpay_client_requests_total counter\n")
+			So(body, ShouldContainSubstring, `bitpay_client_requests_total{endpoint="/invoices/:id",method="GET",status="200"} 2`+"\n")
+			So(body, ShouldContainSubstring, `bitpay_client_requests_total{endpoint="/invoices/:id",method="GET",status="404"} 1`+"\n")
+		})
+
+		Convey("Errors should be counted by class", func() {
+			So(body, ShouldContainSubstring, `bitpay_client_errors_total{endpoint="/invoices/:id",method="GET",class="client"} 1`+"\n")
+			So(body, ShouldContainSubstring, `bitpay_client_errors_total{endpoint="/rates/:currency",method="GET",class="rate_limited"} 1`+"\n")
+			So(body, ShouldNotContainSubstring, `class="none"`)
+		})
+
+		Convey("Latencies should be recorded in cumulative buckets", func() {
+			So(body, ShouldContainSubstring, "# TYPE bitpay_client_request_duration_seconds histogram\n")
+			So(body, ShouldContainSubstring, `bitpay_client_request_duration_seconds_bucket{endpoint="/invoices/:id",method="GET",le="0.1"} 3`+"\n")
+			So(body, ShouldContainSubstring, `bitpay_client_request_duration_seconds_bucket{endpoint="/invoices/:id",method="GET",le="+Inf"} 3`+"\n")
+			So(body, ShouldContainSubstring, `bitpay_client_request_duration_seconds_count{endpoint="/invoices/:id",method="GET"} 3`+"\n")
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"net/http"
+)
+
+type (
+	// SendFunc sends a request to the API and returns the response along with
+	// its body, which has already been read
+	SendFunc func(req *http.Request) (*http.Response, []byte, error)
+
+	// Middleware wraps the sending of the requests of a client, e.g. to add
+	// headers, record metrics or map errors. It gets the request once its
+	// default headers are set, and the response before it is decoded. Retries
+	// and session renewals happen within next.
+	Middleware func(next SendFunc) SendFunc
+)
+
+// WithMiddleware adds middleware around the calls of the client, see Use
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) error {
+		c.Use(middleware...)
+
+		return nil
+	}
+}
+
+// Use adds middleware around the calls of the client. The first middleware
+// added is the outermost one. Use isn't safe to call while the client is
+// making calls.
+func (c *Client) Use(middleware ...Middleware) {
+	c.middleware = append(c.middleware, middleware...)
+}
+
+// BeforeRequest returns a middleware calling f before sending each request.
+// The request isn't sent when f returns an error.
+func BeforeRequest(f func(req *http.Request) error) Middleware {
+	return func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, []byte, error) {
+			if err := f(req); err != nil {
+				return nil, nil, err
+			}
+
+			return next(req)
+		}
+	}
+}
+
+// AfterResponse returns a middleware calling f with the response, its body
+// and error once each request is sent. When f returns an error, the call
+// fails with it as is, instead of the error of the API, if any, and the
+// response isn't decoded.
+func AfterResponse(f func(req *http.Request, resp *http.Response, data []byte, err error) error) Middleware {
+	return func(next SendFunc) SendFunc {
+		return func(req *http.Request) (*http.Response, []byte, error) {
+			resp, data, err := next(req)
+			if mapped := f(req, resp, data, err); mapped != nil {
+				return resp, data, mapped
+			}
+
+			return resp, data, err
+		}
+	}
+}
+
+// send sends a request through the middleware of the client
+func (c *Client) send(req *http.Request) (*http.Response, []byte, error) {
+	send := SendFunc(c.roundTrip)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		send = c.middleware[i](send)
+	}
+
+	return send(req)
+}
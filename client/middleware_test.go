@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMiddleware(t *testing.T) {
+	Convey("With a client using middleware", t, func() {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("X-Request-Id") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Missing request ID"}`))
+				return
+			}
+			w.Write([]byte(`{"data":[{"code":"USD","name":"US Dollar","rate":250}]}`))
+		}))
+		defer server.Close()
+
+		var order []string
+		trace := func(name string) Middleware {
+			return func(next SendFunc) SendFunc {
+				return func(req *http.Request) (*http.Response, []byte, error) {
+					order = append(order, name+" before")
+					resp, data, err := next(req)
+					order = append(order, name+" after")
+
+					return resp, data, err
+				}
+			}
+		}
+
+		bitpay, err := New(WithBaseURL(server.URL), WithMiddleware(trace("outer"), trace("inner")))
+		So(err, ShouldBeNil)
+
+		Convey("Middleware should run in order around the call", func() {
+			bitpay.Use(BeforeRequest(func(req *http.Request) error {
+				req.Header.Set("X-Request-Id", "42")
+				return nil
+			}))
+
+			rates, _, err := bitpay.QueryRates()
+
+			So(err, ShouldBeNil)
+			So(rates, ShouldHaveLength, 1)
+			So(order, ShouldResemble, []string{"outer before", "inner before", "inner after", "outer after"})
+		})
+
+		Convey("An error before the request should stop it", func() {
+			bitpay.Use(BeforeRequest(func(req *http.Request) error {
+				return errors.New("not allowed")
+			}))
+
+			_, _, err := bitpay.QueryRates()
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "not allowed")
+			So(requests, ShouldEqual, 0)
+		})
+
+		Convey("Errors should be mapped after the response", func() {
+			errMissing := errors.New("missing request ID")
+			bitpay.Use(AfterResponse(func(req *http.Request, resp *http.Response, data []byte, err error) error {
+				if err == nil && resp.StatusCode == http.StatusBadRequest {
+					return errMissing
+				}
+				return nil
+			}))
+
+			_, _, err := bitpay.QueryRates()
+
+			So(err, ShouldEqual, errMissing)
+		})
+	})
+}
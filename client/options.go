@@ -0,0 +1,226 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultAPIVersion is sent as the X-Accept-Version header unless
+	// WithAPIVersion is given
+	DefaultAPIVersion = "2.0.0"
+
+	// DefaultRetryPolicy retries failed calls twice, waiting half a second
+	// then a second, when given to WithRetryPolicy. Calls aren't retried
+	// unless a policy is given.
+	DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+)
+
+type (
+	// Option configures a client created by New
+	Option func(*Client) error
+
+	// RetryPolicy tells how calls failing with a network error, a 429 or a 5xx
+	// response are retried. POST requests are retried too, the guid added by
+	// NewRequestWithAuth lets the API detect duplicates.
+	RetryPolicy struct {
+		// MaxAttempts is the number of times a call is made, including the
+		// first one. Calls aren't retried if it is less than 2.
+		MaxAttempts int
+
+		// Backoff is the wait before the first retry, it doubles with each
+		// retry up to MaxBackoff. A Retry-After header takes precedence, up
+		// to MaxBackoff too.
+		Backoff    time.Duration
+		MaxBackoff time.Duration
+	}
+)
+
+// New returns a client configured by the options, it talks to the production
+// API unless WithBaseURL is given
+func New(opts ...Option) (*Client, error) {
+	return newClient(APIBaseProd, opts...)
+}
+
+// newClient returns a client for APIBase, taken as is, configured by the
+// options
+func newClient(APIBase string, opts ...Option) (*Client, error) {
+	client := NewClient(APIBase)
+	for _, opt := range opts {
+		if err := opt(client); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// WithHTTPClient sets the HTTP client used to call the API
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return errors.New("the HTTP client can't be nil")
+		}
+		c.client = httpClient
+
+		return nil
+	}
+}
+
+// WithBaseURL sets the API base, e.g. APIBaseTest
+func WithBaseURL(APIBase string) Option {
+	return func(c *Client) error {
+		if !strings.HasPrefix(APIBase, "http://") && !strings.HasPrefix(APIBase, "https://") {
+			return errors.New("the base URL must be an http or https URL")
+		}
+		c.apiBase = strings.TrimSuffix(APIBase, "/")
+
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the calls
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+
+		return nil
+	}
+}
+
+// WithAPIVersion sets the X-Accept-Version header of the calls
+func WithAPIVersion(version string) Option {
+	return func(c *Client) error {
+		if version == "" {
+			return errors.New("the API version can't be empty")
+		}
+		c.apiVersion = version
+
+		return nil
+	}
+}
+
+// WithLogger logs the calls of the client to logger, e.g. a logger returned
+// by NewTextLogger
+func WithLogger(logger Logger) Option {
+	return func(c *Client) error {
+		c.logger = logger
+
+		return nil
+	}
+}
+
+// WithRetryPolicy retries the calls failing temporarily, see RetryPolicy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+			return errors.New("the retry backoff can't be negative")
+		}
+		c.retry = policy
+
+		return nil
+	}
+}
+
+// WithSigner signs the calls with signer
+func WithSigner(signer Signer) Option {
+	return func(c *Client) error {
+		if signer == nil {
+			return errors.New("the signer can't be nil")
+		}
+		c.signer = signer
+
+		return nil
+	}
+}
+
+// WithPrivateKey signs the calls with a hex encoded private key
+func WithPrivateKey(privateKey string) Option {
+	return func(c *Client) error {
+		signer, err := NewKeySigner(privateKey)
+		if err != nil {
+			return err
+		}
+		c.signer = signer
+
+		return nil
+	}
+}
+
+// WithToken authenticates the calls with a single token, whatever facade
+// they require. Its facade is unknown, so calls aren't checked against it
+// before being sent until it is loaded with LoadTokens, use WithTokens to
+// give it instead.
+func WithToken(token string) Option {
+	return func(c *Client) error {
+		c.token = token
+
+		return nil
+	}
+}
+
+// WithTokens authenticates each call with the token of the facade it
+// requires
+func WithTokens(tokens TokenSet) Option {
+	return func(c *Client) error {
+		for facade, token := range tokens {
+			c.SetToken(facade, token)
+		}
+
+		return nil
+	}
+}
+
+// retryable tells whether a call that failed with resp or err is retried
+func (p RetryPolicy) retryable(attempt int, resp *http.Response, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// wait returns how long to wait before the next attempt
+func (p RetryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	wait, ok := retryAfter(resp)
+	if !ok {
+		wait = p.Backoff << uint(attempt-1)
+	}
+	if p.MaxBackoff > 0 && (wait > p.MaxBackoff || wait < 0) {
+		wait = p.MaxBackoff
+	}
+
+	return wait
+}
+
+// retryAfter returns the delay of the Retry-After header of a response, if
+// it has one, given either in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if wait := time.Until(date); wait > 0 {
+		return wait, true
+	}
+
+	return 0, true
+}
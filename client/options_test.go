@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNew(t *testing.T) {
+	Convey("Creating a client with options", t, func() {
+		Convey("Should return an error for an invalid private key", func() {
+			_, err := New(WithPrivateKey("not a key"))
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should return an error for an invalid base URL", func() {
+			_, err := New(WithBaseURL("test.bitpay.com"))
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Constructors should keep the base URL as is", func() {
+			bitpay := NewClientWithAuth(testPrivateKey, "token", "unix-proxy/")
+
+			So(bitpay.apiBase, ShouldEqual, "unix-proxy/")
+		})
+
+		Convey("Should default to the production API", func() {
+			bitpay, err := New()
+
+			So(err, ShouldBeNil)
+			So(bitpay.apiBase, ShouldEqual, APIBaseProd)
+			So(bitpay.ClientID(), ShouldBeEmpty)
+		})
+
+		Convey("Should configure the calls", func() {
+			var headers http.Header
+			var bodies []string
+			failures := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				headers = r.Header
+				b, _ := ioutil.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+
+				if failures > 0 {
+					failures--
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"error":"unavailable"}`))
+
+					return
+				}
+				w.Write([]byte(`{"data":{"id":"invoice-id"}}`))
+			}))
+			defer server.Close()
+
+			var logs bytes.Buffer
+			bitpay, err := New(
+				WithBaseURL(server.URL),
+				WithHTTPClient(&http.Client{Timeout: time.Second}),
+				WithPrivateKey(testPrivateKey),
+				WithTokens(TokenSet{FacadePOS: "pos-token"}),
+				WithUserAgent("shop/1.0"),
+				WithAPIVersion("2.1.0"),
+				WithLogger(NewTextLogger(&logs, LevelDebug)),
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+			)
+			So(err, ShouldBeNil)
+
+			Convey("Headers should be set", func() {
+				_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+
+				So(err, ShouldBeNil)
+				So(headers.Get("User-Agent"), ShouldEqual, "shop/1.0")
+				So(headers.Get("X-Accept-Version"), ShouldEqual, "2.1.0")
+				So(logs.String(), ShouldContainSubstring, "POST")
+			})
+
+			Convey("Failed calls should be retried with the same body", func() {
+				failures = 2
+				resp, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+
+				So(err, ShouldBeNil)
+				So(resp.StatusCode, ShouldEqual, http.StatusOK)
+				So(bodies, ShouldHaveLength, 3)
+				So(bodies[2], ShouldEqual, bodies[0])
+			})
+
+			Convey("Calls should fail once the attempts are exhausted", func() {
+				failures = 3
+				_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "unavailable")
+				So(bodies, ShouldHaveLength, 3)
+			})
+		})
+	})
+
+	Convey("A retry policy", t, func() {
+		policy := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+
+		Convey("Should back off exponentially up to its maximum", func() {
+			So(policy.wait(1, nil), ShouldEqual, time.Second)
+			So(policy.wait(2, nil), ShouldEqual, 2*time.Second)
+			So(policy.wait(3, nil), ShouldEqual, 3*time.Second)
+		})
+
+		Convey("Should honor Retry-After up to its maximum", func() {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"2"}}}
+
+			So(policy.retryable(1, resp, nil), ShouldBeTrue)
+			So(policy.wait(1, resp), ShouldEqual, 2*time.Second)
+
+			resp.Header.Set("Retry-After", "3600")
+			So(policy.wait(1, resp), ShouldEqual, 3*time.Second)
+		})
+
+		Convey("Should honor Retry-After given as a date", func() {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			So(policy.wait(1, resp), ShouldEqual, 3*time.Second)
+
+			resp.Header.Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+			So(policy.wait(1, resp), ShouldEqual, 0)
+		})
+
+		Convey("Should not retry client errors", func() {
+			So(policy.retryable(1, &http.Response{StatusCode: http.StatusBadRequest}, nil), ShouldBeFalse)
+		})
+	})
+}
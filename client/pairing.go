@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	// DefaultPairingPollInterval is how often WaitForPairing checks whether the
+	// pairing was approved, when no interval is given
+	DefaultPairingPollInterval = 5 * time.Second
+
+	// DefaultPairingTimeout is how long WaitForPairing waits for a pairing
+	// code the API gave no expiration
+	DefaultPairingTimeout = 24 * time.Hour
+
+	// ErrPairingExpired is returned when a pairing code expires before it was
+	// approved
+	ErrPairingExpired = errors.New("pairing code expired before it was approved")
+)
+
+type (
+	// Pairing is a token request awaiting approval in the merchant dashboard
+	Pairing struct {
+		Token       TokenResp
+		ApprovalURL string
+	}
+
+	// PairingOptions configures Pair
+	PairingOptions struct {
+		// PollInterval defaults to DefaultPairingPollInterval
+		PollInterval time.Duration
+
+		// Store receives the token once approved, if set
+		Store TokenStore
+
+		// Pending is called with the pairing before waiting for its approval,
+		// e.g. to show the approval URL
+		Pending func(*Pairing)
+	}
+
+	// TokenStore persists tokens obtained by pairing
+	TokenStore interface {
+		StoreToken(t TokenResp) error
+	}
+
+	// Credentials holds a private key and the tokens paired with its client
+	// ID. It is stored as plain JSON, readable by its owner only.
+	Credentials struct {
+		PrivateKey string               `json:"privateKey"`
+		SIN        string               `json:"sin"`
+		Tokens     map[Facade]TokenResp `json:"tokens"`
+
+		path string
+	}
+)
+
+// Pair requests a token for the facade, waits until it is approved and adds
+// it to the client. The approved token is saved to opts.Store if set. Waiting
+// stops when the context of the client, set with WithContext, is done.
+func (c *Client) Pair(label string, facade Facade, opts PairingOptions) (TokenResp, error) {
+	p, err := c.RequestPairing(label, facade)
+	if err != nil {
+		return TokenResp{}, err
+	}
+
+	if opts.Pending != nil {
+		opts.Pending(p)
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	token, err := c.WaitForPairing(ctx, p, opts.PollInterval)
+	if err != nil {
+		return token, err
+	}
+
+	if opts.Store != nil {
+		err = opts.Store.StoreToken(token)
+	}
+
+	return token, err
+}
+
+// RequestPairing requests a token for the facade for the client ID of the
+// client. The token can't be used until the pairing code is approved at the
+// returned approval URL.
+func (c *Client) RequestPairing(label string, facade Facade) (*Pairing, error) {
+	if c.ClientID() == "" {
+		return nil, errors.New("pairing requires a client with a signer")
+	}
+
+	token, err := c.NewToken(label, c.ClientID(), facade)
+	if err != nil {
+		return nil, err
+	}
+	if token.PairingCode == "" {
+		return nil, errors.New("no pairing code was returned for the token")
+	}
+
+	return &Pairing{
+		Token:       token,
+		ApprovalURL: fmt.Sprintf("%s/api-access-request?pairingCode=%s", c.apiBase, url.QueryEscape(token.PairingCode)),
+	}, nil
+}
+
+// WaitForPairing polls the tokens of the client ID until the token of the
+// pairing becomes active, then adds it to the client. ErrPairingExpired is
+// returned once the pairing code expires, or after DefaultPairingTimeout if
+// it has no expiration, and the error of ctx once it is done. Polls failing
+// with network errors or server errors are retried.
+func (c *Client) WaitForPairing(ctx context.Context, p *Pairing, interval time.Duration) (TokenResp, error) {
+	if interval <= 0 {
+		interval = DefaultPairingPollInterval
+	}
+
+	expires := time.Now().Add(DefaultPairingTimeout)
+	if p.Token.PairingExpiration != 0 {
+		expires = p.Token.PairingExpiresAt()
+	}
+
+	for {
+		tokens, resp, err := c.WithContext(ctx).QueryTokens()
+		if ctx.Err() != nil {
+			return TokenResp{}, ctx.Err()
+		}
+		if err != nil && !transientError(resp, err) {
+			return TokenResp{}, err
+		}
+
+		for _, t := range tokens {
+			if t.Token != p.Token.Token || !t.Active() {
+				continue
+			}
+
+			token := p.Token
+			token.Policies = t.Policies
+			token.PairingCode = ""
+			token.PairingExpiration = 0
+			if t.Facade != nil {
+				token.Facade = t.Facade
+			}
+			c.AddToken(token)
+
+			return token, nil
+		}
+
+		wait := time.Until(expires)
+		if wait <= 0 {
+			return TokenResp{}, ErrPairingExpired
+		}
+		if wait > interval {
+			wait = interval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return TokenResp{}, ctx.Err()
+		}
+	}
+}
+
+// transientError tells whether a call failed with a network error or a
+// server error, which may not happen again
+func transientError(resp *http.Response, err error) bool {
+	if resp != nil {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	}
+	_, ok := err.(*url.Error)
+
+	return ok
+}
+
+// LoadCredentials reads a credentials file, an empty one is returned if it
+// doesn't exist
+func LoadCredentials(path string) (*Credentials, error) {
+	creds := &Credentials{Tokens: make(map[Facade]TokenResp), path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, creds); err != nil {
+		return nil, err
+	}
+	if creds.Tokens == nil {
+		creds.Tokens = make(map[Facade]TokenResp)
+	}
+
+	return creds, nil
+}
+
+// Save writes the credentials back to the file they were loaded from
+func (c *Credentials) Save() error {
+	b, err := json.MarshalIndent(c, "", "	")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.path, b, 0600)
+}
+
+// StoreToken implements TokenStore, the credentials file is saved right away
+func (c *Credentials) StoreToken(t TokenResp) error {
+	c.Tokens[t.FacadeName()] = t
+
+	return c.Save()
+}
+
+// TokenSet returns the tokens of the credentials by facade
+func (c *Credentials) TokenSet() TokenSet {
+	tokens := make(TokenSet)
+	for f, t := range c.Tokens {
+		tokens[f] = t.Token
+	}
+
+	return tokens
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPairing(t *testing.T) {
+	Convey("Pairing a new token", t, func() {
+		polls := 0
+		expiration := time.Now().Add(time.Hour).UnixNano() / int64(time.Millisecond)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "POST":
+				w.Write([]byte(`{"data":[{"token":"new-token","facade":"merchant","label":"Shop","pairingCode":"abc1234","pairingExpiration":` +
+					strconv.FormatInt(expiration, 10) + `,"policies":[{"policy":"id","method":"inactive","params":["Tf"]}]}]}`))
+			case "GET":
+				polls++
+				if polls == 1 {
+					// A transient failure, the poll should be retried
+					w.WriteHeader(http.StatusServiceUnavailable)
+				} else if polls < 3 {
+					w.Write([]byte(`{"data":[{"pos":"other-token"}]}`))
+				} else {
+					w.Write([]byte(`{"data":[{"pos":"other-token"},{"merchant":"new-token"}]}`))
+				}
+			}
+		}))
+		defer server.Close()
+
+		bitpay := NewClientWithAuth(testPrivateKey, "", server.URL)
+
+		Convey("Should point to the approval page of the pairing code", func() {
+			p, err := bitpay.RequestPairing("Shop", FacadeMerchant)
+
+			So(err, ShouldBeNil)
+			So(p.Token.Active(), ShouldBeFalse)
+			So(p.ApprovalURL, ShouldEqual, server.URL+"/api-access-request?pairingCode=abc1234")
+		})
+
+		Convey("Should wait for the approval and store the token", func() {
+			dir, err := ioutil.TempDir("", "bitpay")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			creds, err := LoadCredentials(filepath.Join(dir, "credentials.json"))
+			So(err, ShouldBeNil)
+
+			var pending *Pairing
+			token, err := bitpay.Pair("Shop", FacadeMerchant, PairingOptions{
+				PollInterval: time.Millisecond,
+				Store:        creds,
+				Pending:      func(p *Pairing) { pending = p },
+			})
+
+			So(err, ShouldBeNil)
+			So(pending, ShouldNotBeNil)
+			So(polls, ShouldEqual, 3)
+			So(token.Token, ShouldEqual, "new-token")
+			So(token.Active(), ShouldBeTrue)
+			So(token.Label, ShouldEqual, "Shop")
+			So(bitpay.Tokens()[FacadeMerchant], ShouldEqual, "new-token")
+
+			saved, err := LoadCredentials(filepath.Join(dir, "credentials.json"))
+			So(err, ShouldBeNil)
+			So(saved.TokenSet(), ShouldResemble, TokenSet{FacadeMerchant: "new-token"})
+		})
+
+		Convey("Should give up once the pairing code expired", func() {
+			merchant := FacadeMerchant
+			_, err := bitpay.WaitForPairing(context.Background(), &Pairing{Token: TokenResp{
+				Token:             "expired-token",
+				Facade:            &merchant,
+				PairingExpiration: expiration - int64(2*time.Hour/time.Millisecond),
+				Policies:          []Policy{{Policy: "id", Method: "inactive"}},
+			}}, time.Millisecond)
+
+			So(err, ShouldEqual, ErrPairingExpired)
+		})
+
+		Convey("Should give up once the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			merchant := FacadeMerchant
+			_, err := bitpay.WaitForPairing(ctx, &Pairing{Token: TokenResp{
+				Token:    "unexpiring-token",
+				Facade:   &merchant,
+				Policies: []Policy{{Policy: "id", Method: "inactive"}},
+			}}, time.Millisecond)
+
+			So(err == context.DeadlineExceeded, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+type (
+	// ProxyCaller is a service allowed to call the API through a proxy. It
+	// authenticates with its key as a bearer token.
+	ProxyCaller struct {
+		Name string `json:"name"`
+		Key  string `json:"key"`
+
+		// Allow lists the calls the caller can make, as a method and a path,
+		// e.g. "POST /invoices" or "GET /invoices/*". The method can be * and
+		// a * path segment matches any value.
+		Allow []string `json:"allow"`
+	}
+
+	// ProxyConfig is the configuration file of a proxy
+	ProxyConfig struct {
+		Callers []ProxyCaller `json:"callers"`
+	}
+
+	proxy struct {
+		client  *Client
+		callers []ProxyCaller
+	}
+)
+
+// hopHeaders aren't forwarded by the proxy
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// LoadProxyConfig reads a proxy configuration file
+func LoadProxyConfig(filename string) (*ProxyConfig, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var config ProxyConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+
+	for _, caller := range config.Callers {
+		if caller.Key == "" {
+			return nil, fmt.Errorf("caller %s has no key", caller.Name)
+		}
+		for _, rule := range caller.Allow {
+			if _, _, err := parseProxyRule(rule); err != nil {
+				return nil, fmt.Errorf("caller %s: %s", caller.Name, err)
+			}
+		}
+	}
+
+	return &config, nil
+}
+
+// NewProxy returns a handler forwarding unsigned requests of the callers to
+// the API of the client. The token, guid and signature headers are added the
+// same way NewRequestWithAuth does, so callers never see the private key or
+// the tokens. Any token sent by a caller is replaced.
+func NewProxy(c *Client, callers []ProxyCaller) http.Handler {
+	return &proxy{client: c, callers: callers}
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	caller := p.authenticate(r)
+	if caller == nil {
+		writeProxyError(w, http.StatusUnauthorized, "unknown caller")
+		return
+	}
+
+	// Decoded ? and # would end the path of the forwarded call, so paths
+	// holding them are never allowed
+	urlPath := path.Clean("/" + r.URL.Path)
+	if strings.ContainsAny(urlPath, "?#") || !caller.allows(r.Method, urlPath) {
+		writeProxyError(w, http.StatusForbidden, fmt.Sprintf("%s is not allowed to call %s %s", caller.Name, r.Method, urlPath))
+		return
+	}
+
+	var payload interface{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		if err := d.Decode(&payload); err != nil {
+			writeProxyError(w, http.StatusBadRequest, "the request body is not valid JSON")
+			return
+		}
+		m, ok := payload.(map[string]interface{})
+		if !ok {
+			writeProxyError(w, http.StatusBadRequest, "the request body is not a JSON object")
+			return
+		}
+		delete(m, "token")
+	}
+
+	query := r.URL.Query()
+	query.Del("token")
+	base, err := url.Parse(p.client.apiBase)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	endpoint := url.URL{
+		Scheme:   base.Scheme,
+		Host:     base.Host,
+		Path:     strings.TrimSuffix(base.Path, "/") + urlPath,
+		RawQuery: query.Encode(),
+	}
+
+	// The call is canceled along with the request of the caller
+	bitpay := p.client.WithContext(r.Context())
+
+	req, err := bitpay.NewRequestWithAuth(r.Method, endpoint.String(), payload)
+	if err != nil {
+		status := http.StatusBadGateway
+		if _, ok := err.(*FacadeError); ok {
+			status = http.StatusForbidden
+		}
+		writeProxyError(w, status, err.Error())
+		return
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Accept-Version", bitpay.apiVersion)
+	if v := r.Header.Get("X-Accept-Version"); v != "" {
+		req.Header.Set("X-Accept-Version", v)
+	}
+
+	bitpay.log(LevelInfo, "proxying call", Field{"caller", caller.Name}, Field{"method", req.Method}, Field{"endpoint", bitpay.endpoint(req)})
+
+	req, cancel := bitpay.withContext(req)
+	defer cancel()
+
+	resp, data, err := bitpay.send(req)
+	if err != nil {
+		writeProxyError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(data)
+}
+
+func (p *proxy) authenticate(r *http.Request) *ProxyCaller {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	key := []byte(strings.TrimPrefix(auth, "Bearer "))
+
+	for i := range p.callers {
+		if subtle.ConstantTimeCompare(key, []byte(p.callers[i].Key)) == 1 {
+			return &p.callers[i]
+		}
+	}
+
+	return nil
+}
+
+func (caller *ProxyCaller) allows(method, urlPath string) bool {
+	for _, rule := range caller.Allow {
+		m, pattern, err := parseProxyRule(rule)
+		if err != nil {
+			continue
+		}
+		if m != "*" && m != method {
+			continue
+		}
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseProxyRule(rule string) (method, pattern string, err error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "/") {
+		return "", "", fmt.Errorf("invalid rule %q, expected a method and a path", rule)
+	}
+	if _, err := path.Match(fields[1], "/"); err != nil {
+		return "", "", fmt.Errorf("invalid rule %q: %s", rule, err)
+	}
+
+	return strings.ToUpper(fields[0]), fields[1], nil
+}
+
+func writeProxyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Error: message})
+}
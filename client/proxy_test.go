@@ -0,0 +1,139 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProxy(t *testing.T) {
+	Convey("With a proxy in front of the API", t, func() {
+		var received *http.Request
+		var receivedBody map[string]interface{}
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			receivedBody = nil
+			json.NewDecoder(r.Body).Decode(&receivedBody)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"data":{"id":"invoice-id"}}`))
+		}))
+		defer api.Close()
+
+		bitpay := NewClientWithTokens(testPrivateKey, TokenSet{FacadePOS: "pos-token"}, api.URL)
+		proxy := httptest.NewServer(NewProxy(bitpay, []ProxyCaller{
+			{Name: "shop", Key: "shop-key", Allow: []string{"POST /invoices", "GET /invoices/*"}},
+			{Name: "reports", Key: "reports-key", Allow: []string{"* /ledgers/*"}},
+		}))
+		defer proxy.Close()
+
+		call := func(method, path, key, body string) *http.Response {
+			req, err := http.NewRequest(method, proxy.URL+path, strings.NewReader(body))
+			So(err, ShouldBeNil)
+			if key != "" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+
+			return resp
+		}
+
+		Convey("A POST should be signed with the token and a guid added", func() {
+			resp := call("POST", "/invoices", "shop-key", `{"price":10.5,"currency":"USD","token":"spoofed"}`)
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+
+			So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+			So(string(b), ShouldEqual, `{"data":{"id":"invoice-id"}}`)
+			So(received.Header.Get("X-Identity"), ShouldNotBeEmpty)
+			So(received.Header.Get("X-Signature"), ShouldNotBeEmpty)
+			So(received.Header.Get("X-Accept-Version"), ShouldEqual, "2.0.0")
+			So(receivedBody["token"], ShouldEqual, "pos-token")
+			So(receivedBody["guid"], ShouldNotBeEmpty)
+			So(receivedBody["price"], ShouldEqual, 10.5)
+		})
+
+		Convey("A GET should carry the token as a query parameter", func() {
+			resp := call("GET", "/invoices/abc?token=spoofed", "shop-key", "")
+			resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusCreated)
+			So(received.URL.Path, ShouldEqual, "/invoices/abc")
+			So(received.URL.Query()["token"], ShouldResemble, []string{"pos-token"})
+		})
+
+		Convey("A body that isn't a JSON object should be rejected", func() {
+			resp := call("POST", "/invoices", "shop-key", `[{"price":10.5}]`)
+			resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(received, ShouldBeNil)
+		})
+
+		Convey("Unknown callers should be rejected", func() {
+			resp := call("POST", "/invoices", "wrong-key", `{}`)
+			resp.Body.Close()
+
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+			So(received, ShouldBeNil)
+		})
+
+		Convey("Calls outside of the allowlist should be rejected", func() {
+			bitpay.SetToken(FacadeMerchant, "merchant-token")
+
+			for _, path := range []string{"/invoices", "/invoices/abc/refunds", "/invoices/../ledgers/BTC",
+				"/invoices/%3F", "/invoices/%23x", "/invoices/%3Fstatus=complete"} {
+				resp := call("GET", path, "shop-key", "")
+				resp.Body.Close()
+
+				So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+			}
+			So(received, ShouldBeNil)
+		})
+
+		Convey("Calls the tokens can't make should be rejected before being sent", func() {
+			resp := call("GET", "/ledgers/BTC", "reports-key", "")
+			defer resp.Body.Close()
+
+			var r Response
+			json.NewDecoder(resp.Body).Decode(&r)
+
+			So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+			So(r.Error, ShouldContainSubstring, "merchant")
+			So(received, ShouldBeNil)
+		})
+	})
+
+	Convey("Loading a proxy configuration", t, func() {
+		dir, err := ioutil.TempDir("", "bitpay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "proxy.json")
+
+		Convey("Should read the callers", func() {
+			ioutil.WriteFile(filename, []byte(`{"callers":[{"name":"shop","key":"k","allow":["POST /invoices"]}]}`), 0600)
+			config, err := LoadProxyConfig(filename)
+
+			So(err, ShouldBeNil)
+			So(config.Callers, ShouldHaveLength, 1)
+			So(config.Callers[0].allows("POST", "/invoices"), ShouldBeTrue)
+			So(config.Callers[0].allows("GET", "/invoices"), ShouldBeFalse)
+		})
+
+		Convey("Should reject invalid rules", func() {
+			ioutil.WriteFile(filename, []byte(`{"callers":[{"name":"shop","key":"k","allow":["/invoices"]}]}`), 0600)
+			_, err := LoadProxyConfig(filename)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	DiscrepancyMissingCredit    DiscrepancyKind = "missing_credit"
+	DiscrepancyAmountMismatch   DiscrepancyKind = "amount_mismatch"
+	DiscrepancyUnexpectedFee    DiscrepancyKind = "unexpected_fee"
+	DiscrepancyUnexpectedCredit DiscrepancyKind = "unexpected_credit"
+	DiscrepancyOrphanEntry      DiscrepancyKind = "orphan_entry"
+
+	// DefaultMaxFeeRate is the fee rate used when ReconcileOptions has none
+	DefaultMaxFeeRate = 0.01
+
+	// DefaultSettledStatuses are the invoice statuses expected to have a
+	// ledger credit when ReconcileOptions has none
+	DefaultSettledStatuses = []InvoiceStatus{InvoiceStatusConfirmed, InvoiceStatusComplete}
+)
+
+type (
+	// DiscrepancyKind identifies the problem found by the reconciler
+	DiscrepancyKind string
+
+	// ReconcileOptions tunes how invoices and ledger entries are matched
+	ReconcileOptions struct {
+		// Tolerance is the absolute difference allowed between amounts
+		Tolerance float64
+
+		// MaxFeeRate is the largest expected fee as a fraction of the invoice
+		// credit, larger fees are flagged. DefaultMaxFeeRate is used when nil,
+		// a rate of 0 flags any fee.
+		MaxFeeRate *float64
+
+		// SettledStatuses are the invoice statuses expected to have a credit
+		SettledStatuses []InvoiceStatus
+
+		// SettlementWindow extends the ledger range fetched by ReconcileLedger
+		// past the end date, so invoices created at the end of the range can
+		// still be matched with their credit
+		SettlementWindow time.Duration
+	}
+
+	// Discrepancy is a single mismatch between invoices and ledger entries
+	Discrepancy struct {
+		Kind      DiscrepancyKind `json:"kind"`
+		InvoiceID string          `json:"invoiceId,omitempty"`
+		Entry     *LedgerEntry    `json:"entry,omitempty"`
+		Expected  float64         `json:"expected"`
+		Actual    float64         `json:"actual"`
+		Message   string          `json:"message"`
+	}
+
+	// ReconciliationReport is the result of reconciling invoices against the
+	// ledger of a currency
+	ReconciliationReport struct {
+		Currency      string        `json:"currency"`
+		Start         time.Time     `json:"start"`
+		End           time.Time     `json:"end"`
+		Invoices      int           `json:"invoices"`
+		Entries       int           `json:"entries"`
+		Matched       int           `json:"matched"`
+		Discrepancies []Discrepancy `json:"discrepancies"`
+	}
+)
+
+// ReconcileLedger fetches the invoices and the ledger entries of currency
+// between startDate and endDate, and reconciles them. All the invoices are
+// joined against the entries, but only those created in the range are
+// expected to have a credit.
+func (c *Client) ReconcileLedger(currency string, startDate, endDate time.Time, opts ReconcileOptions) (*ReconciliationReport, error) {
+	invoices, _, err := c.QueryInvoices()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _, err := c.GetLedger(currency, startDate, endDate.Add(opts.SettlementWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	// The ledger is fetched by day, so is the invoice range
+	start := startDate.UTC().Truncate(24 * time.Hour)
+	end := endDate.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+
+	inRange := func(i Invoice) bool {
+		t := i.CreatedAt()
+		return !t.Before(start) && t.Before(end)
+	}
+
+	report := reconcile(currency, invoices, entries, opts, inRange)
+	report.Start = startDate
+	report.End = endDate
+
+	return report, nil
+}
+
+// Reconcile joins invoices against the ledger entries of currency by invoice
+// ID. It flags settled invoices without a credit, credits that don't match
+// the invoice price, fees above the expected rate and entries that don't
+// belong to any of the invoices.
+func Reconcile(currency string, invoices []Invoice, entries []LedgerEntry, opts ReconcileOptions) *ReconciliationReport {
+	return reconcile(currency, invoices, entries, opts, nil)
+}
+
+// reconcile implements Reconcile. Only the invoices for which expected
+// returns true, or all of them if it is nil, are expected to have a credit,
+// the others are only joined against the entries belonging to them.
+func reconcile(currency string, invoices []Invoice, entries []LedgerEntry, opts ReconcileOptions, expected func(Invoice) bool) *ReconciliationReport {
+	maxFeeRate := DefaultMaxFeeRate
+	if opts.MaxFeeRate != nil {
+		maxFeeRate = *opts.MaxFeeRate
+	}
+	if len(opts.SettledStatuses) == 0 {
+		opts.SettledStatuses = DefaultSettledStatuses
+	}
+	tolerance := math.Max(opts.Tolerance, 1e-9)
+
+	report := &ReconciliationReport{
+		Currency:      currency,
+		Entries:       len(entries),
+		Discrepancies: []Discrepancy{},
+	}
+
+	byInvoice := make(map[string][]LedgerEntry)
+	for _, e := range entries {
+		switch e.Category() {
+		case LedgerCategoryInvoice, LedgerCategoryFee, LedgerCategoryRefund:
+		default:
+			// Payouts and exchanges aren't tied to invoices
+			continue
+		}
+
+		if e.InvoiceID == "" {
+			report.add(Discrepancy{
+				Kind:    DiscrepancyOrphanEntry,
+				Entry:   copyEntry(e),
+				Actual:  e.Value(),
+				Message: fmt.Sprintf("%s entry has no invoice ID", e.Category()),
+			})
+			continue
+		}
+		byInvoice[e.InvoiceID] = append(byInvoice[e.InvoiceID], e)
+	}
+
+	for _, i := range invoices {
+		related, ok := byInvoice[i.ID]
+		delete(byInvoice, i.ID)
+
+		due := expected == nil || expected(i)
+		if !due && !ok {
+			// Out of the range, and without entries in it
+			continue
+		}
+		report.Invoices++
+
+		var credit, fees, invoiceAmount float64
+		credits := 0
+		for _, e := range related {
+			switch e.Category() {
+			case LedgerCategoryInvoice:
+				credit += e.Value()
+				invoiceAmount += e.InvoiceAmount
+				credits++
+			case LedgerCategoryFee:
+				fees += -e.Value()
+			}
+		}
+
+		settled := false
+		for _, s := range opts.SettledStatuses {
+			if i.Status == s {
+				settled = true
+			}
+		}
+
+		price := float64(i.Price)
+		var found []Discrepancy
+		switch {
+		case settled && credits == 0 && due:
+			found = append(found, Discrepancy{
+				Kind:      DiscrepancyMissingCredit,
+				InvoiceID: i.ID,
+				Expected:  price,
+				Message:   fmt.Sprintf("invoice is %s but has no ledger credit", i.Status),
+			})
+		case !settled && credits > 0:
+			found = append(found, Discrepancy{
+				Kind:      DiscrepancyUnexpectedCredit,
+				InvoiceID: i.ID,
+				Actual:    credit,
+				Message:   fmt.Sprintf("invoice is %s but has a ledger credit", i.Status),
+			})
+		}
+
+		if credits > 0 {
+			// Compare in the invoice currency when the credit was converted
+			actual := credit
+			if i.Currency != currency {
+				actual = invoiceAmount
+			}
+			if (i.Currency == currency || invoiceAmount != 0) && math.Abs(actual-price) > tolerance {
+				found = append(found, Discrepancy{
+					Kind:      DiscrepancyAmountMismatch,
+					InvoiceID: i.ID,
+					Expected:  price,
+					Actual:    actual,
+					Message:   fmt.Sprintf("ledger credit of %g %s doesn't match invoice price %g %s", actual, i.Currency, price, i.Currency),
+				})
+			}
+		}
+
+		if fees > 0 && fees > credit*maxFeeRate+tolerance {
+			found = append(found, Discrepancy{
+				Kind:      DiscrepancyUnexpectedFee,
+				InvoiceID: i.ID,
+				Expected:  credit * maxFeeRate,
+				Actual:    fees,
+				Message:   fmt.Sprintf("fees of %g %s exceed %g%% of the credit", fees, currency, maxFeeRate*100),
+			})
+		}
+
+		if !ok && !settled {
+			// Nothing was expected and nothing was found
+			continue
+		}
+		if len(found) == 0 {
+			report.Matched++
+		}
+		for _, d := range found {
+			report.add(d)
+		}
+	}
+
+	// Whatever is left doesn't belong to any of the invoices
+	ids := make([]string, 0, len(byInvoice))
+	for id := range byInvoice {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, e := range byInvoice[id] {
+			report.add(Discrepancy{
+				Kind:      DiscrepancyOrphanEntry,
+				InvoiceID: id,
+				Entry:     copyEntry(e),
+				Actual:    e.Value(),
+				Message:   fmt.Sprintf("%s entry for unknown invoice", e.Category()),
+			})
+		}
+	}
+
+	return report
+}
+
+// Count returns the number of discrepancies of the given kind
+func (r *ReconciliationReport) Count(kind DiscrepancyKind) int {
+	n := 0
+	for _, d := range r.Discrepancies {
+		if d.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
+
+// WriteSummary writes a human readable summary of the report to w
+func (r *ReconciliationReport) WriteSummary(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "Reconciliation of the %s ledger", r.Currency)
+	if !r.Start.IsZero() {
+		fmt.Fprintf(bw, " from %s to %s", r.Start.Format(ledgerDateFormat), r.End.Format(ledgerDateFormat))
+	}
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, "  %d invoices, %d ledger entries, %d invoices matched\n", r.Invoices, r.Entries, r.Matched)
+
+	if len(r.Discrepancies) == 0 {
+		fmt.Fprintln(bw, "  no discrepancies found")
+
+		return bw.Flush()
+	}
+
+	fmt.Fprintf(bw, "  %d discrepancies found:\n", len(r.Discrepancies))
+	for _, kind := range []DiscrepancyKind{DiscrepancyMissingCredit, DiscrepancyAmountMismatch, DiscrepancyUnexpectedFee, DiscrepancyUnexpectedCredit, DiscrepancyOrphanEntry} {
+		if n := r.Count(kind); n > 0 {
+			fmt.Fprintf(bw, "    %-18s %d\n", kind, n)
+		}
+	}
+	fmt.Fprintln(bw)
+
+	for _, d := range r.Discrepancies {
+		id := d.InvoiceID
+		if id == "" {
+			id = "-"
+		}
+		fmt.Fprintf(bw, "  %-18s %-24s %s\n", d.Kind, id, d.Message)
+	}
+
+	return bw.Flush()
+}
+
+func (r *ReconciliationReport) add(d Discrepancy) {
+	r.Discrepancies = append(r.Discrepancies, d)
+}
+
+func copyEntry(e LedgerEntry) *LedgerEntry {
+	return &e
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReconcile(t *testing.T) {
+	Convey("Reconciling invoices against the ledger", t, func() {
+		invoices := []Invoice{
+			{ID: "matched", Price: 100, Currency: "USD", Status: InvoiceStatusComplete},
+			{ID: "missing", Price: 50, Currency: "USD", Status: InvoiceStatusComplete},
+			{ID: "mismatch", Price: 20, Currency: "USD", Status: InvoiceStatusConfirmed},
+			{ID: "expensive", Price: 10, Currency: "USD", Status: InvoiceStatusComplete},
+			{ID: "expired", Price: 10, Currency: "USD", Status: InvoiceStatusExpired},
+			{ID: "unpaid", Price: 10, Currency: "USD", Status: InvoiceStatusNew},
+		}
+		entries := []LedgerEntry{
+			{Code: LedgerEntryInvoice, Amount: 10000, Scale: 100, InvoiceID: "matched"},
+			{Code: LedgerEntryInvoiceFee, Amount: -100, Scale: 100, InvoiceID: "matched"},
+			{Code: LedgerEntryInvoice, Amount: 1900, Scale: 100, InvoiceID: "mismatch"},
+			{Code: LedgerEntryInvoice, Amount: 1000, Scale: 100, InvoiceID: "expensive"},
+			{Code: LedgerEntryInvoiceFee, Amount: -50, Scale: 100, InvoiceID: "expensive"},
+			{Code: LedgerEntryInvoice, Amount: 1000, Scale: 100, InvoiceID: "expired"},
+			{Code: LedgerEntryInvoice, Amount: 500, Scale: 100, InvoiceID: "unknown"},
+			{Code: LedgerEntryInvoiceFee, Amount: -5, Scale: 100},
+			{Code: LedgerEntryPayout, Amount: -10000, Scale: 100},
+		}
+
+		report := Reconcile("USD", invoices, entries, ReconcileOptions{})
+
+		Convey("Should count the matched invoices", func() {
+			So(report.Invoices, ShouldEqual, 6)
+			So(report.Entries, ShouldEqual, 9)
+			So(report.Matched, ShouldEqual, 1)
+		})
+
+		Convey("Should flag each kind of discrepancy", func() {
+			So(report.Count(DiscrepancyMissingCredit), ShouldEqual, 1)
+			So(report.Count(DiscrepancyAmountMismatch), ShouldEqual, 1)
+			So(report.Count(DiscrepancyUnexpectedFee), ShouldEqual, 1)
+			So(report.Count(DiscrepancyUnexpectedCredit), ShouldEqual, 1)
+			So(report.Count(DiscrepancyOrphanEntry), ShouldEqual, 2)
+			So(len(report.Discrepancies), ShouldEqual, 6)
+		})
+
+		Convey("Should report expected and actual amounts", func() {
+			for _, d := range report.Discrepancies {
+				if d.Kind == DiscrepancyAmountMismatch {
+					So(d.InvoiceID, ShouldEqual, "mismatch")
+					So(d.Expected, ShouldEqual, 20)
+					So(d.Actual, ShouldEqual, 19)
+				}
+			}
+		})
+
+		Convey("Should compare converted credits in the invoice currency", func() {
+			report := Reconcile("BTC", []Invoice{
+				{ID: "converted", Price: 100, Currency: "USD", Status: InvoiceStatusComplete},
+			}, []LedgerEntry{
+				{Code: LedgerEntryInvoice, Amount: 40000000, Scale: 100000000, InvoiceID: "converted", InvoiceAmount: 100, InvoiceCurrency: "USD"},
+			}, ReconcileOptions{})
+
+			So(report.Matched, ShouldEqual, 1)
+			So(report.Discrepancies, ShouldBeEmpty)
+		})
+
+		Convey("Should flag any fee when the fee rate is 0", func() {
+			rate := 0.0
+			report := Reconcile("USD", invoices[:1], entries[:2], ReconcileOptions{MaxFeeRate: &rate})
+
+			So(report.Count(DiscrepancyUnexpectedFee), ShouldEqual, 1)
+		})
+
+		Convey("Should only expect credits for the invoices in the range", func() {
+			before := Invoice{ID: "before", Price: 10, Currency: "USD", Status: InvoiceStatusComplete}
+			unsettled := Invoice{ID: "unsettled", Price: 10, Currency: "USD", Status: InvoiceStatusComplete}
+			inRange := func(i Invoice) bool { return i.ID != before.ID && i.ID != unsettled.ID }
+
+			report := reconcile("USD", []Invoice{invoices[0], before, unsettled}, []LedgerEntry{
+				entries[0],
+				{Code: LedgerEntryInvoice, Amount: 1000, Scale: 100, InvoiceID: "before"},
+			}, ReconcileOptions{}, inRange)
+
+			So(report.Invoices, ShouldEqual, 2)
+			So(report.Matched, ShouldEqual, 2)
+			So(report.Discrepancies, ShouldBeEmpty)
+		})
+
+		Convey("Should be machine readable", func() {
+			b, err := json.Marshal(report)
+
+			So(err, ShouldBeNil)
+			So(string(b), ShouldContainSubstring, `"kind":"missing_credit","invoiceId":"missing"`)
+		})
+
+		Convey("Should summarize the discrepancies", func() {
+			var buf bytes.Buffer
+
+			So(report.WriteSummary(&buf), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "6 invoices, 9 ledger entries, 1 invoices matched")
+			So(buf.String(), ShouldContainSubstring, "6 discrepancies found")
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// The services below group the calls of Client by resource, so code using
+// the API can depend on the calls it needs and use the mocks of the
+// clientmock package in its tests.
+
+var (
+	_ API                = (*Client)(nil)
+	_ ApplicationService = (*Client)(nil)
+	_ BillService        = (*Client)(nil)
+	_ ClientService      = (*Client)(nil)
+	_ CurrencyService    = (*Client)(nil)
+	_ InvoiceService     = (*Client)(nil)
+	_ LedgerService      = (*Client)(nil)
+	_ PairingService     = (*Client)(nil)
+	_ PayoutService      = (*Client)(nil)
+	_ RateService        = (*Client)(nil)
+	_ TokenService       = (*Client)(nil)
+	_ UserService        = (*Client)(nil)
+)
+
+type (
+	// API holds all the services of the API
+	API interface {
+		ApplicationService
+		BillService
+		ClientService
+		CurrencyService
+		InvoiceService
+		LedgerService
+		PairingService
+		PayoutService
+		RateService
+		TokenService
+		UserService
+	}
+
+	// ApplicationService creates applications
+	ApplicationService interface {
+		CreateApplication(a Application) (*http.Response, error)
+	}
+
+	// BillService manages bills
+	BillService interface {
+		CreateBill(b Bill) (*http.Response, error)
+		QueryBills() ([]Bill, *http.Response, error)
+		GetBill(ID string) (*Bill, *http.Response, error)
+		UpdateBill(b Bill) (*http.Response, error)
+	}
+
+	// ClientService manages the clients paired with the account
+	ClientService interface {
+		QueryClients() ([]BitpayClient, *http.Response, error)
+		GetClient(clientID string) (*BitpayClient, *http.Response, error)
+		DeleteClient(clientID string) (*http.Response, error)
+	}
+
+	// CurrencyService lists the supported currencies
+	CurrencyService interface {
+		QueryCurrencies() ([]Currency, *http.Response, error)
+	}
+
+	// InvoiceService manages invoices and their refunds
+	InvoiceService interface {
+		CreateInvoice(i Invoice) (*http.Response, error)
+		QueryInvoices() ([]Invoice, *http.Response, error)
+		GetInvoice(ID string) (*Invoice, *http.Response, error)
+		GetInvoiceEvents(ID string) (*EventResp, *http.Response, error)
+		CreateInvoiceRefund(invoiceID string, r InvoiceRefund) (*http.Response, error)
+		DeleteInvoiceRefund(invoiceID, refundID string) (*http.Response, error)
+		AcceptInvoiceAdjustment(invoiceID string, adjustment InvoiceAdjustment) (*http.Response, error)
+		CreateInvoiceNotification(invoiceID string) (*http.Response, error)
+	}
+
+	// LedgerService reads the ledgers
+	LedgerService interface {
+		QueryLedgers() ([]Ledger, *http.Response, error)
+		GetLedger(currency string, startDate, endDate time.Time) ([]LedgerEntry, *http.Response, error)
+		LoadLedgerAnalytics(since time.Time, currencies ...string) (*LedgerAnalytics, error)
+		ReconcileLedger(currency string, startDate, endDate time.Time, opts ReconcileOptions) (*ReconciliationReport, error)
+	}
+
+	// PairingService pairs clients with the account
+	PairingService interface {
+		Pair(label string, facade Facade, opts PairingOptions) (TokenResp, error)
+		RequestPairing(label string, facade Facade) (*Pairing, error)
+		WaitForPairing(ctx context.Context, p *Pairing, interval time.Duration) (TokenResp, error)
+	}
+
+	// PayoutService manages payout batches
+	PayoutService interface {
+		CreatePayout(p Payout) (*http.Response, error)
+		QueryPayouts() ([]Payout, *http.Response, error)
+		GetPayout(ID string) (*Payout, *http.Response, error)
+		UpdatePayout(p Payout) (*http.Response, error)
+		DeletePayout(payoutID string) (*http.Response, error)
+		CreatePayoutsReports() (*http.Response, error)
+	}
+
+	// RateService returns exchange rates
+	RateService interface {
+		QueryRates() ([]Rate, *http.Response, error)
+		GetRateForCurrency(currencyCode string) (*Rate, *http.Response, error)
+	}
+
+	// TokenService manages the tokens of the account
+	TokenService interface {
+		NewToken(label, clientID string, facade Facade) (TokenResp, error)
+		ClaimToken(label, clientID, pairingCode string) (TokenResp, error)
+		QueryTokens() ([]TokenResp, *http.Response, error)
+		GetToken(token string) (*TokenResp, *http.Response, error)
+	}
+
+	// UserService reads and updates the user of the account
+	UserService interface {
+		GetUser() (*User, *http.Response, error)
+		UpdateUser(u User) (*User, *http.Response, error)
+	}
+)
@@ -3,12 +3,31 @@ package client
 // https://test.bitpay.com/api#resource-Sessions
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 )
 
-// Session is a unique session ID to protect against replay attacks
-type Session string
+// SessionErrors are the errors the API rejects calls with when their session
+// expired or their nonce isn't greater than the last one, the session is
+// renewed when a call fails with one of them
+var SessionErrors = []string{"Invalid session", "Invalid nonce"}
+
+type (
+	// Session is a unique session ID to protect against replay attacks
+	Session string
+
+	// session holds the session of a client in session mode. Its lock is held
+	// while a request is signed and sent, so requests reach the API in the
+	// order of their nonces.
+	session struct {
+		sync.Mutex
+		id    Session
+		nonce int64
+	}
+)
 
 // CreateSession creates an API session to protect against replay attacks
 // and ensure requests are received in the same order they are sent.
@@ -23,3 +42,99 @@ func (c *Client) CreateSession() (Session, *http.Response, error) {
 
 	return session, resp, err
 }
+
+// WithSessions enables session mode. A session is created before the first
+// authenticated call, then every call carries its ID and an increasing nonce.
+// Calls are sent one at a time, and the session is renewed when the API
+// rejects it or the nonce.
+func WithSessions() Option {
+	return func(c *Client) error {
+		c.session = &session{}
+
+		return nil
+	}
+}
+
+// Session returns the current session ID of a client in session mode, empty
+// if none was created yet
+func (c *Client) Session() Session {
+	if c.session == nil {
+		return ""
+	}
+
+	c.session.Lock()
+	defer c.session.Unlock()
+
+	return c.session.id
+}
+
+// roundTrip signs ar with the next nonce of the session and sends it with the
+// headers of req, signing it again with a new nonce for each retry. A call
+// rejected because of its session or nonce is sent again once, in a new
+// session. The request last sent is returned along with its response.
+func (s *session) roundTrip(c *Client, req *http.Request, ar *authRequest) (*http.Request, *http.Response, []byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var sent *http.Request
+	sign := func() (*http.Request, error) {
+		s.nonce++
+		signed, err := c.sign(ar, s.id, s.nonce)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range req.Header {
+			if _, ok := signed.Header[k]; !ok {
+				signed.Header[k] = v
+			}
+		}
+		sent = signed.WithContext(req.Context())
+
+		return sent, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		if s.id == "" {
+			id, _, err := c.CreateSession()
+			if err != nil {
+				return req, nil, nil, err
+			}
+			s.id = id
+			s.nonce = 0
+		}
+
+		first, err := sign()
+		if err != nil {
+			return req, nil, nil, err
+		}
+
+		resp, data, err := c.attempt(first, sign)
+		if err != nil || attempt > 1 || !sessionRejected(resp, data) {
+			return sent, resp, data, err
+		}
+
+		c.log(LevelInfo, "renewing session", Field{"nonce", s.nonce})
+		s.id = ""
+	}
+}
+
+// sessionRejected tells whether the API rejected a call with one of the
+// SessionErrors
+func sessionRejected(resp *http.Response, data []byte) bool {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false
+	}
+
+	var r Response
+	if json.Unmarshal(data, &r) != nil {
+		return false
+	}
+
+	for _, msg := range SessionErrors {
+		if strings.EqualFold(strings.TrimSpace(r.Error), msg) {
+			return true
+		}
+	}
+
+	return false
+}
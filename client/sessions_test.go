@@ -0,0 +1,160 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSessionMode(t *testing.T) {
+	Convey("With a client in session mode", t, func() {
+		var mu sync.Mutex
+		sessions := 0
+		nonces := make(map[string][]int64)
+		rejectNext := false
+		failNext := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if r.URL.Path == "/sessions" {
+				sessions++
+				fmt.Fprintf(w, `{"data":"session-%d"}`, sessions)
+				return
+			}
+
+			var id string
+			var nonce int64
+			if r.Method == "POST" {
+				var body struct {
+					SessionID string `json:"sessionId"`
+					Nonce     int64  `json:"nonce"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				id, nonce = body.SessionID, body.Nonce
+			} else {
+				id = r.URL.Query().Get("sessionId")
+				nonce, _ = strconv.ParseInt(r.URL.Query().Get("nonce"), 10, 64)
+			}
+
+			seen := nonces[id]
+			if rejectNext || id == "" || (len(seen) > 0 && nonce <= seen[len(seen)-1]) {
+				rejectNext = false
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"Invalid nonce"}`))
+				return
+			}
+			nonces[id] = append(seen, nonce)
+
+			if failNext != "" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, `{"error":%q}`, failNext)
+				failNext = ""
+				return
+			}
+
+			w.Write([]byte(`{"data":{"id":"invoice-id"}}`))
+		}))
+		defer server.Close()
+
+		var sent *http.Request
+		bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"), WithSessions(),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+			WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req.Clone(req.Context())
+				if req.GetBody != nil {
+					sent.Body, _ = req.GetBody()
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			})}))
+		So(err, ShouldBeNil)
+
+		Convey("A session should be created before the first call", func() {
+			So(bitpay.Session(), ShouldBeEmpty)
+
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+			_, _, err = bitpay.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+
+			So(sessions, ShouldEqual, 1)
+			So(bitpay.Session(), ShouldEqual, Session("session-1"))
+			So(nonces["session-1"], ShouldResemble, []int64{1, 2})
+		})
+
+		Convey("Concurrent calls should reach the API in nonce order", func() {
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _, err := bitpay.GetInvoice("invoice-id")
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+			So(nonces["session-1"], ShouldHaveLength, 20)
+		})
+
+		Convey("A rejected nonce should renew the session and retry the call", func() {
+			_, _, err := bitpay.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+
+			rejectNext = true
+			_, _, err = bitpay.GetInvoice("invoice-id")
+
+			So(err, ShouldBeNil)
+			So(sessions, ShouldEqual, 2)
+			So(bitpay.Session(), ShouldEqual, Session("session-2"))
+			So(nonces["session-2"], ShouldResemble, []int64{1})
+		})
+
+		Convey("A retried call should be signed with a new nonce", func() {
+			failNext = "Service unavailable"
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+
+			So(err, ShouldBeNil)
+			So(sessions, ShouldEqual, 1)
+			So(nonces["session-1"], ShouldResemble, []int64{1, 2})
+
+			v, err := VerifyRequest(sent)
+			So(err, ShouldBeNil)
+			So(v.Message, ShouldContainSubstring, `"nonce":2`)
+		})
+
+		Convey("Other errors mentioning the session shouldn't renew it", func() {
+			bitpay.retry = RetryPolicy{}
+			failNext = "Refunds aren't allowed in this session"
+			_, _, err := bitpay.GetInvoice("invoice-id")
+
+			So(err, ShouldNotBeNil)
+			So(sessions, ShouldEqual, 1)
+		})
+
+		Convey("Requests should only be signed when sent", func() {
+			req, err := bitpay.NewRequestWithAuth("GET", server.URL+"/invoices/invoice-id", nil)
+			So(err, ShouldBeNil)
+
+			_, err = VerifyRequest(req)
+			So(err, ShouldEqual, ErrSessionRequestNotSigned)
+		})
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
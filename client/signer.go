@@ -0,0 +1,388 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fundary/bitauth"
+)
+
+// DefaultSignerTimeout is how long a RemoteSigner waits for the signer to
+// answer a call
+var DefaultSignerTimeout = 10 * time.Second
+
+type (
+	// Signer signs API requests on behalf of a client ID, so the private key
+	// doesn't have to live in the Client
+	Signer interface {
+		// PublicKey returns the hex encoded compressed public key, sent as the
+		// X-Identity header
+		PublicKey() string
+
+		// SIN returns the client ID derived from the public key
+		SIN() string
+
+		// Sign returns the hex encoded signature of message, sent as the
+		// X-Signature header
+		Sign(message string) (string, error)
+	}
+
+	// KeySigner signs with a private key held in memory
+	KeySigner struct {
+		privateKey string
+		publicKey  string
+		sin        string
+	}
+
+	// KeystoreSigner signs with the private key of a keystore, following its
+	// key rotations
+	KeystoreSigner struct {
+		keystore *Keystore
+	}
+
+	// unixListener removes its socket file once closed
+	unixListener struct {
+		*net.UnixListener
+		path string
+	}
+
+	// RemoteSigner delegates signing to a signer running in another process,
+	// served by ServeSigner over HTTP or a Unix socket
+	RemoteSigner struct {
+		client    *http.Client
+		base      string
+		key       string
+		publicKey string
+		sin       string
+	}
+
+	signerIdentity struct {
+		PublicKey string `json:"publicKey"`
+		SIN       string `json:"sin"`
+	}
+
+	signerRequest struct {
+		Message string `json:"message"`
+	}
+
+	signerResponse struct {
+		Signature string `json:"signature,omitempty"`
+		Error     string `json:"error,omitempty"`
+	}
+)
+
+// NewKeySigner returns a signer for a hex encoded private key
+func NewKeySigner(privateKey string) (*KeySigner, error) {
+	publicKey, sin, err := DeriveIdentity(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySigner{privateKey: privateKey, publicKey: publicKey, sin: sin}, nil
+}
+
+// PublicKey implements Signer
+func (s *KeySigner) PublicKey() string {
+	return s.publicKey
+}
+
+// SIN implements Signer
+func (s *KeySigner) SIN() string {
+	return s.sin
+}
+
+// Sign implements Signer
+func (s *KeySigner) Sign(message string) (string, error) {
+	return bitauth.Sign(message, s.privateKey)
+}
+
+// Signer returns a signer using the private key of the keystore
+func (k *Keystore) Signer() *KeystoreSigner {
+	return &KeystoreSigner{keystore: k}
+}
+
+// PublicKey implements Signer
+func (s *KeystoreSigner) PublicKey() string {
+	s.keystore.mu.RLock()
+	defer s.keystore.mu.RUnlock()
+
+	return s.keystore.PublicKey
+}
+
+// SIN implements Signer
+func (s *KeystoreSigner) SIN() string {
+	s.keystore.mu.RLock()
+	defer s.keystore.mu.RUnlock()
+
+	return s.keystore.SIN
+}
+
+// Sign implements Signer
+func (s *KeystoreSigner) Sign(message string) (string, error) {
+	s.keystore.mu.RLock()
+	privateKey := s.keystore.PrivateKey
+	s.keystore.mu.RUnlock()
+
+	return bitauth.Sign(message, privateKey)
+}
+
+// NewRemoteSigner connects to a signer served by ServeSigner. addr is either
+// an HTTP URL, e.g. http://127.0.0.1:8090, or the path of a Unix socket
+// prefixed by unix:, e.g. unix:/run/bitpay/signer.sock. key is the key the
+// signer was served with, if any. The identity of the signer is fetched
+// right away.
+func NewRemoteSigner(addr, key string) (*RemoteSigner, error) {
+	s := &RemoteSigner{
+		client: &http.Client{Timeout: DefaultSignerTimeout},
+		base:   strings.TrimSuffix(addr, "/"),
+		key:    key,
+	}
+
+	if strings.HasPrefix(addr, "unix:") {
+		path := strings.TrimPrefix(addr, "unix:")
+		s.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		s.base = "http://signer"
+	}
+
+	var identity signerIdentity
+	if err := s.call("GET", "/identity", nil, &identity); err != nil {
+		return nil, err
+	}
+	if identity.PublicKey == "" || identity.SIN == "" {
+		return nil, errors.New("remote signer returned an empty identity")
+	}
+	s.publicKey = identity.PublicKey
+	s.sin = identity.SIN
+
+	return s, nil
+}
+
+// PublicKey implements Signer
+func (s *RemoteSigner) PublicKey() string {
+	return s.publicKey
+}
+
+// SIN implements Signer
+func (s *RemoteSigner) SIN() string {
+	return s.sin
+}
+
+// Sign implements Signer
+func (s *RemoteSigner) Sign(message string) (string, error) {
+	var resp signerResponse
+	if err := s.call("POST", "/sign", signerRequest{Message: message}, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.Signature, nil
+}
+
+func (s *RemoteSigner) call(method, path string, payload, v interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, s.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.key != "" {
+		req.Header.Set("Authorization", "Bearer "+s.key)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var r signerResponse
+		if json.Unmarshal(data, &r) == nil && r.Error != "" {
+			return fmt.Errorf("remote signer: %s", r.Error)
+		}
+
+		return fmt.Errorf("remote signer: %s", resp.Status)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// NewSignerHandler returns the HTTP handler serving a signer to
+// RemoteSigner clients. It only answers requests made to a loopback host,
+// so that web pages can't reach it through DNS rebinding, and requires key
+// as a bearer token unless it is empty.
+func NewSignerHandler(s Signer, key string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/identity", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeSignerResponse(w, http.StatusMethodNotAllowed, signerResponse{Error: "method not allowed"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signerIdentity{PublicKey: s.PublicKey(), SIN: s.SIN()})
+	})
+
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeSignerResponse(w, http.StatusMethodNotAllowed, signerResponse{Error: "method not allowed"})
+			return
+		}
+
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeSignerResponse(w, http.StatusUnsupportedMediaType, signerResponse{Error: "the request body must be JSON"})
+			return
+		}
+
+		var req signerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" {
+			writeSignerResponse(w, http.StatusBadRequest, signerResponse{Error: "a message is required"})
+			return
+		}
+
+		signature, err := s.Sign(req.Message)
+		if err != nil {
+			writeSignerResponse(w, http.StatusInternalServerError, signerResponse{Error: err.Error()})
+			return
+		}
+
+		writeSignerResponse(w, http.StatusOK, signerResponse{Signature: signature})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !loopbackHost(r.Host) {
+			writeSignerResponse(w, http.StatusForbidden, signerResponse{Error: "the signer only serves loopback hosts"})
+			return
+		}
+		if key != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+key)) != 1 {
+			writeSignerResponse(w, http.StatusUnauthorized, signerResponse{Error: "a valid signer key is required"})
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ServeSigner serves a signer on addr, in the same format as the one given
+// to NewRemoteSigner, see ListenSigner. Any local process can connect to TCP
+// addresses, so they require a key, given to NewRemoteSigner by clients.
+func ServeSigner(addr string, s Signer, key string) error {
+	if !strings.HasPrefix(addr, "unix:") && key == "" {
+		return fmt.Errorf("a key is required to serve the signer on %s, or use a Unix socket", addr)
+	}
+
+	l, err := ListenSigner(addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return http.Serve(l, NewSignerHandler(s, key))
+}
+
+// loopbackHost returns true if the Host header of a request names localhost,
+// a loopback address, or the placeholder host of Unix sockets
+func loopbackHost(hostPort string) bool {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host = strings.Trim(hostPort, "[]")
+	}
+	if host == "signer" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// ListenSigner listens on addr for RemoteSigner clients. Only Unix sockets,
+// accessible by their owner only, and loopback TCP addresses are accepted.
+func ListenSigner(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return listenUnix(strings.TrimPrefix(addr, "unix:"))
+	}
+
+	hostPort := strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "tcp:")
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("signer address %s isn't a loopback address, use a Unix socket or 127.0.0.1", addr)
+	}
+
+	return net.Listen("tcp", hostPort)
+}
+
+// listenUnix creates the socket in a private directory and moves it to path
+// once it is readable by its owner only, so it is never reachable by others
+func listenUnix(path string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".bitpay-signer")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "signer.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, 0600)
+	if err == nil {
+		os.Remove(path)
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// Close implements net.Listener
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+
+	return err
+}
+
+func writeSignerResponse(w http.ResponseWriter, status int, resp signerResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failingSigner struct {
+	*KeySigner
+}
+
+func (failingSigner) Sign(message string) (string, error) {
+	return "", errors.New("key is locked")
+}
+
+func TestSigner(t *testing.T) {
+	Convey("With a key signer", t, func() {
+		signer, err := NewKeySigner(testPrivateKey)
+		So(err, ShouldBeNil)
+
+		publicKey, sin, err := DeriveIdentity(testPrivateKey)
+		So(err, ShouldBeNil)
+		So(signer.PublicKey(), ShouldEqual, publicKey)
+		So(signer.SIN(), ShouldEqual, sin)
+
+		Convey("An invalid private key should be rejected", func() {
+			_, err := NewKeySigner("not hex")
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("A client should sign its requests with it", func() {
+			bitpay := NewClientWithSigner(signer, "token", APIBaseTest)
+			req, err := bitpay.NewRequestWithAuth("GET", APIBaseTest+"/invoices", nil)
+
+			So(err, ShouldBeNil)
+			So(bitpay.ClientID(), ShouldEqual, sin)
+			So(req.Header.Get("X-Identity"), ShouldEqual, publicKey)
+			So(req.Header.Get("X-Signature"), ShouldNotBeEmpty)
+		})
+
+		Convey("A client without a signer should not make authenticated requests", func() {
+			_, err := NewClient(APIBaseTest).NewRequestWithAuth("GET", APIBaseTest+"/invoices", nil)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Served over HTTP", func() {
+			server := httptest.NewServer(NewSignerHandler(signer, "signer-key"))
+			defer server.Close()
+
+			remote, err := NewRemoteSigner(server.URL, "signer-key")
+			So(err, ShouldBeNil)
+
+			Convey("The remote signer should have the same identity", func() {
+				So(remote.PublicKey(), ShouldEqual, publicKey)
+				So(remote.SIN(), ShouldEqual, sin)
+			})
+
+			Convey("The remote signer should sign requests", func() {
+				bitpay := NewClientWithSigner(remote, "token", APIBaseTest)
+				req, err := bitpay.NewRequestWithAuth("POST", APIBaseTest+"/invoices", map[string]interface{}{"price": 1})
+
+				So(err, ShouldBeNil)
+				So(req.Header.Get("X-Identity"), ShouldEqual, publicKey)
+				So(req.Header.Get("X-Signature"), ShouldNotBeEmpty)
+			})
+
+			Convey("Clients without the key should be rejected", func() {
+				_, err := NewRemoteSigner(server.URL, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "remote signer: a valid signer key is required")
+
+				_, err = NewRemoteSigner(server.URL, "other-key")
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("Requests to other hosts should be rejected", func() {
+				req, err := http.NewRequest("POST", server.URL+"/sign", strings.NewReader(`{"message":"message"}`))
+				So(err, ShouldBeNil)
+				req.Host = "attacker.example.com"
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer signer-key")
+
+				resp, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				resp.Body.Close()
+				So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+			})
+
+			Convey("Messages should only be signed from JSON requests", func() {
+				req, err := http.NewRequest("POST", server.URL+"/sign", strings.NewReader(`{"message":"message"}`))
+				So(err, ShouldBeNil)
+				req.Header.Set("Content-Type", "text/plain")
+				req.Header.Set("Authorization", "Bearer signer-key")
+
+				resp, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				resp.Body.Close()
+				So(resp.StatusCode, ShouldEqual, http.StatusUnsupportedMediaType)
+			})
+		})
+
+		Convey("Signers should require a key on TCP addresses", func() {
+			err := ServeSigner("127.0.0.1:0", signer, "")
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Served over a Unix socket", func() {
+			dir, err := ioutil.TempDir("", "bitpay")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "signer.sock")
+
+			l, err := ListenSigner("unix:" + path)
+			So(err, ShouldBeNil)
+			defer l.Close()
+			go http.Serve(l, NewSignerHandler(signer, ""))
+
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+			remote, err := NewRemoteSigner("unix:"+path, "")
+			So(err, ShouldBeNil)
+			So(remote.SIN(), ShouldEqual, sin)
+
+			signature, err := remote.Sign("message")
+			So(err, ShouldBeNil)
+			So(signature, ShouldNotBeEmpty)
+		})
+
+		Convey("Only loopback TCP addresses should be served", func() {
+			_, err := ListenSigner("0.0.0.0:0")
+			So(err, ShouldNotBeNil)
+
+			_, err = ListenSigner(":0")
+			So(err, ShouldNotBeNil)
+
+			l, err := ListenSigner("127.0.0.1:0")
+			So(err, ShouldBeNil)
+			So(l.Close(), ShouldBeNil)
+		})
+
+		Convey("Signing errors of the remote signer should be returned", func() {
+			server := httptest.NewServer(NewSignerHandler(failingSigner{signer}, ""))
+			defer server.Close()
+
+			remote, err := NewRemoteSigner(server.URL, "")
+			So(err, ShouldBeNil)
+
+			_, err = remote.Sign("message")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "remote signer: key is locked")
+
+			_, err = NewClientWithSigner(remote, "token", APIBaseTest).NewRequestWithAuth("GET", APIBaseTest+"/invoices", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A keystore signer should follow key rotations", t, func() {
+		defer func(n int) { KeystoreScryptN = n }(KeystoreScryptN)
+		KeystoreScryptN = 1 << 10
+
+		dir, err := ioutil.TempDir("", "bitpay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		k, err := CreateKeystore(filepath.Join(dir, "keystore.json"), []byte("secret"), testPrivateKey)
+		So(err, ShouldBeNil)
+
+		signer := k.Signer()
+		So(signer.SIN(), ShouldEqual, k.SIN)
+
+		So(k.RotateKey(), ShouldBeNil)
+		So(signer.SIN(), ShouldEqual, k.SIN)
+		So(signer.PublicKey(), ShouldEqual, k.PublicKey)
+	})
+}
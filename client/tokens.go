@@ -2,12 +2,16 @@ package client
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 )
 
 type (
+	// TokenResp maps to a resource at the tokens endpoint
 	TokenResp struct {
 		Policies          []Policy `json:"policies"`
 		Token             string   `json:"token"`
@@ -18,6 +22,7 @@ type (
 		PairingCode       string   `json:"pairingCode"`
 	}
 
+	// Policy restricts how a token can be used, e.g. to a given client ID
 	Policy struct {
 		Policy string   `json:"policy"`
 		Method string   `json:"method"`
@@ -72,3 +77,141 @@ func (c *Client) ClaimToken(label, clientID, pairingCode string) (TokenResp, err
 
 	return tokenResps[0], err
 }
+
+// QueryTokens returns the tokens held by the calling client ID
+func (c *Client) QueryTokens() ([]TokenResp, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/tokens", c.apiBase), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tokens []TokenResp
+	resp, err := c.Send(req, &tokens)
+
+	return tokens, resp, err
+}
+
+// GetToken returns the specified token held by the calling client ID
+func (c *Client) GetToken(token string) (*TokenResp, *http.Response, error) {
+	req, err := c.NewRequestWithAuth("GET", fmt.Sprintf("%s/tokens/%s", c.apiBase, token), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tokenResp TokenResp
+	resp, err := c.Send(req, &tokenResp)
+
+	return &tokenResp, resp, err
+}
+
+// UnmarshalJSON decodes a token resource, or the {"<facade>": "<token>"}
+// shorthand used when listing tokens
+func (t *TokenResp) UnmarshalJSON(data []byte) error {
+	type tokenResp TokenResp
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	if len(fields) == 1 {
+		for facade, raw := range fields {
+			var token string
+			isString := len(raw) > 0 && raw[0] == '"'
+			if f := Facade(facade); f.known() && isString && json.Unmarshal(raw, &token) == nil {
+				*t = TokenResp{Token: token, Facade: &f}
+
+				return nil
+			}
+		}
+	}
+
+	return json.Unmarshal(data, (*tokenResp)(t))
+}
+
+// known returns whether the facade is one of the facades of the API
+func (f Facade) known() bool {
+	for _, known := range defaultFacades {
+		if f == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FacadeName returns the facade of the token, or an empty facade if unknown
+func (t TokenResp) FacadeName() Facade {
+	if t.Facade == nil {
+		return ""
+	}
+
+	return *t.Facade
+}
+
+// Active returns false while the pairing of the token awaits approval
+func (t TokenResp) Active() bool {
+	for _, p := range t.Policies {
+		if p.Policy == "id" && p.Method == "inactive" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PairingExpiresAt returns the time the pairing code of the token expires,
+// or the zero time if it has none
+func (t TokenResp) PairingExpiresAt() time.Time {
+	if t.PairingExpiration == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, t.PairingExpiration*int64(time.Millisecond))
+}
+
+// PairingExpired returns true if the token was never approved and its
+// pairing code has expired at the given time
+func (t TokenResp) PairingExpired(now time.Time) bool {
+	if t.Active() || t.PairingExpiration == 0 {
+		return false
+	}
+
+	return !now.Before(t.PairingExpiresAt())
+}
+
+// Includes returns true if the capabilities of the facade are a superset of
+// the ones of other. The merchant facade includes the pos facade, every
+// facade includes the public one.
+func (f Facade) Includes(other Facade) bool {
+	switch {
+	case f == other, other == FacadePublic:
+		return true
+	case f == FacadeMerchant && other == FacadePOS:
+		return true
+	}
+
+	return false
+}
+
+// TokenForFacade picks the token to use for calls requiring the given facade
+// among tokens, e.g. the ones returned by QueryTokens. A token issued for the
+// facade itself is preferred over one whose facade includes it, inactive and
+// expired tokens are skipped.
+func TokenForFacade(tokens []TokenResp, facade Facade) (TokenResp, bool) {
+	var found TokenResp
+	ok := false
+	for _, t := range tokens {
+		if !t.Active() || t.Token == "" || !t.FacadeName().Includes(facade) {
+			continue
+		}
+		if t.FacadeName() == facade {
+			return t, true
+		}
+		if !ok {
+			found, ok = t, true
+		}
+	}
+
+	return found, ok
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenResp(t *testing.T) {
+	Convey("With tokens", t, func() {
+		Convey("The facade shorthand should be decoded", func() {
+			var tokens []TokenResp
+			err := json.Unmarshal([]byte(`[{"pos":"abc"},{"token":"def","facade":"merchant","label":"Shop"}]`), &tokens)
+
+			So(err, ShouldBeNil)
+			So(len(tokens), ShouldEqual, 2)
+			So(tokens[0].Token, ShouldEqual, "abc")
+			So(tokens[0].FacadeName(), ShouldEqual, FacadePOS)
+			So(tokens[1].Token, ShouldEqual, "def")
+			So(tokens[1].FacadeName(), ShouldEqual, FacadeMerchant)
+			So(tokens[1].Label, ShouldEqual, "Shop")
+		})
+
+		Convey("Single field resources shouldn't be taken for the shorthand", func() {
+			var tokens []TokenResp
+			err := json.Unmarshal([]byte(`[{"label":"Shop"},{"pos":null}]`), &tokens)
+
+			So(err, ShouldBeNil)
+			So(tokens[0].Token, ShouldBeEmpty)
+			So(tokens[0].Label, ShouldEqual, "Shop")
+			So(tokens[1].Facade, ShouldBeNil)
+		})
+
+		Convey("A pairing awaiting approval should expire", func() {
+			expiration := time.Date(2015, 3, 14, 0, 0, 0, 0, time.UTC)
+			token := TokenResp{
+				Token:             "abc",
+				PairingExpiration: expiration.UnixNano() / int64(time.Millisecond),
+				Policies:          []Policy{{Policy: "id", Method: "inactive", Params: []string{"Tf123"}}},
+			}
+
+			So(token.Active(), ShouldBeFalse)
+			So(token.PairingExpiresAt().Equal(expiration), ShouldBeTrue)
+			So(token.PairingExpired(expiration.Add(-time.Second)), ShouldBeFalse)
+			So(token.PairingExpired(expiration), ShouldBeTrue)
+
+			token.Policies[0].Method = "require"
+			So(token.PairingExpired(expiration), ShouldBeFalse)
+		})
+
+		Convey("The token of the exact facade should be preferred", func() {
+			pos, merchant := FacadePOS, FacadeMerchant
+			tokens := []TokenResp{
+				{Token: "merchant", Facade: &merchant},
+				{Token: "pos", Facade: &pos},
+			}
+
+			token, ok := TokenForFacade(tokens, FacadePOS)
+			So(ok, ShouldBeTrue)
+			So(token.Token, ShouldEqual, "pos")
+
+			token, ok = TokenForFacade(tokens[:1], FacadePOS)
+			So(ok, ShouldBeTrue)
+			So(token.Token, ShouldEqual, "merchant")
+
+			_, ok = TokenForFacade(tokens[1:], FacadeMerchant)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
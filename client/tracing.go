@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type (
+	// Tracer starts spans, implement it to plug the client into a tracing
+	// backend
+	Tracer interface {
+		// Start starts a span named name, as a child of the span of ctx if
+		// any, and returns a context holding the new span
+		Start(ctx context.Context, name string) (context.Context, Span)
+	}
+
+	// Span is an operation being traced
+	Span interface {
+		SetAttribute(key string, value interface{})
+		RecordError(err error)
+		End()
+	}
+
+	// operationKey holds the name of the operation of a request in its
+	// context, for requests whose route names another operation
+	operationKey struct{}
+)
+
+// WithTracer traces the calls of the client. Each call is a span named after
+// its operation, e.g. bitpay.CreateInvoice, with a child span per attempt.
+// Calls of a client returned by WithContext are children of the span of the
+// context.
+func WithTracer(tracer Tracer) Option {
+	return func(c *Client) error {
+		c.tracer = tracer
+		c.Use(c.trace)
+
+		return nil
+	}
+}
+
+// WithContext returns a copy of the client making its calls with ctx. They
+// are canceled along with ctx, and traced as children of its span. Requests
+// passed to Send keep the deadline and cancellation of their own context, but
+// its values are replaced by those of ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	clone := *c
+	clone.ctx = ctx
+	clone.middleware = append([]Middleware(nil), c.middleware...)
+
+	return &clone
+}
+
+// withContext returns the request with the context of the client, keeping the
+// values the client stored in the context of the request, and its deadline
+// and cancellation. cancel releases the merged context once the call is done.
+func (c *Client) withContext(req *http.Request) (*http.Request, context.CancelFunc) {
+	if c.ctx == nil {
+		return req, func() {}
+	}
+
+	parent := req.Context()
+	ctx := c.ctx
+	for _, key := range []interface{}{authRequestKey{}, operationKey{}} {
+		if v := parent.Value(key); v != nil {
+			ctx = context.WithValue(ctx, key, v)
+		}
+	}
+	if parent.Done() == nil {
+		return req.WithContext(ctx), func() {}
+	}
+
+	var cancel context.CancelFunc
+	if deadline, ok := parent.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-parent.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return req.WithContext(ctx), func() {
+		close(done)
+		cancel()
+	}
+}
+
+// withOperation names the operation of a request whose route names another
+// one
+func withOperation(req *http.Request, operation string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), operationKey{}, operation))
+}
+
+// operation returns the name of the operation of a request, from its route
+func (c *Client) operation(req *http.Request) string {
+	if operation, ok := req.Context().Value(operationKey{}).(string); ok {
+		return operation
+	}
+	if r, ok := findRoute(req.Method, c.routePath(req.URL)); ok {
+		return r.operation
+	}
+
+	return "Call"
+}
+
+// trace is the middleware tracing the calls of the client
+func (c *Client) trace(next SendFunc) SendFunc {
+	return func(req *http.Request) (*http.Response, []byte, error) {
+		operation := c.operation(req)
+		ctx, span := c.tracer.Start(req.Context(), "bitpay."+operation)
+		defer span.End()
+
+		endpoint := c.endpoint(req)
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("bitpay.endpoint", endpoint)
+
+		resp, data, err := next(withOperation(req.WithContext(ctx), operation))
+		if err != nil {
+			span.RecordError(err)
+			return resp, data, err
+		}
+
+		span.SetAttribute("http.status_code", resp.StatusCode)
+		if key, id := resourceID(c.routePath(req.URL), data); id != "" {
+			span.SetAttribute(key, id)
+		}
+		r := Response{}
+		if json.Unmarshal(data, &r) == nil && r.Error != "" {
+			span.RecordError(errors.New(r.Error))
+		}
+
+		return resp, data, err
+	}
+}
+
+// startAttempt starts the span of an attempt to send a request, when the
+// client is traced
+func (c *Client) startAttempt(req *http.Request, attempt int) (*http.Request, Span) {
+	if c.tracer == nil {
+		return req, nil
+	}
+
+	operation, _ := req.Context().Value(operationKey{}).(string)
+	ctx, span := c.tracer.Start(req.Context(), "bitpay."+operation+".attempt")
+	span.SetAttribute("bitpay.attempt", attempt)
+	span.SetAttribute("bitpay.retry", attempt > 1)
+
+	return req.WithContext(ctx), span
+}
+
+// endAttempt ends the span of an attempt, if any
+func endAttempt(span Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+	span.End()
+}
+
+// resourceID returns the attribute and the ID of the invoice, payout or bill
+// of a call, from its path or, for created resources, its response
+func resourceID(path string, data []byte) (string, string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	var key string
+	switch segments[0] {
+	case "invoices":
+		key = "bitpay.invoice_id"
+	case "payouts":
+		key = "bitpay.payout_id"
+	case "bills":
+		key = "bitpay.bill_id"
+	default:
+		return "", ""
+	}
+
+	if len(segments) > 1 {
+		return key, segments[1]
+	}
+
+	var r struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.Unmarshal(data, &r)
+
+	return key, r.Data.ID
+}
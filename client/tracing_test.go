@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type (
+	testTracer struct {
+		sync.Mutex
+		spans []*testSpan
+	}
+
+	testSpan struct {
+		name       string
+		parent     *testSpan
+		attributes map[string]interface{}
+		errors     []error
+		ended      bool
+	}
+
+	testSpanKey struct{}
+)
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.Lock()
+	defer t.Unlock()
+
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.errors = append(s.errors, err) }
+func (s *testSpan) End()                                       { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	Convey("With a traced client", t, func() {
+		failures := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error":"unavailable"}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"id":"created-id"}}`))
+		}))
+		defer server.Close()
+
+		tracer := &testTracer{}
+		bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"), WithTracer(tracer),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+		So(err, ShouldBeNil)
+
+		Convey("Calls should be spans named after their operation", func() {
+			_, _, err := bitpay.GetPayout("payout-id")
+			So(err, ShouldBeNil)
+
+			So(tracer.spans, ShouldHaveLength, 2)
+			call := tracer.spans[0]
+			So(call.name, ShouldEqual, "bitpay.GetPayout")
+			So(call.ended, ShouldBeTrue)
+			So(call.attributes["bitpay.endpoint"], ShouldEqual, "/payouts/:id")
+			So(call.attributes["bitpay.payout_id"], ShouldEqual, "payout-id")
+			So(call.attributes["http.status_code"], ShouldEqual, http.StatusOK)
+		})
+
+		Convey("Created resources should be identified from the response", func() {
+			_, err := bitpay.CreateInvoice(Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			So(tracer.spans[0].name, ShouldEqual, "bitpay.CreateInvoice")
+			So(tracer.spans[0].attributes["bitpay.invoice_id"], ShouldEqual, "created-id")
+		})
+
+		Convey("Calls should be children of the span of the context", func() {
+			ctx, parent := tracer.Start(context.Background(), "checkout")
+
+			_, _, err := bitpay.WithContext(ctx).GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+
+			So(tracer.spans[1].name, ShouldEqual, "bitpay.GetInvoice")
+			So(tracer.spans[1].parent, ShouldEqual, parent)
+		})
+
+		Convey("Retries should be child spans of the call", func() {
+			failures = 2
+			_, _, err := bitpay.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+
+			So(tracer.spans, ShouldHaveLength, 4)
+			call := tracer.spans[0]
+			for i, attempt := range tracer.spans[1:] {
+				So(attempt.name, ShouldEqual, "bitpay.GetInvoice.attempt")
+				So(attempt.parent, ShouldEqual, call)
+				So(attempt.attributes["bitpay.attempt"], ShouldEqual, i+1)
+				So(attempt.ended, ShouldBeTrue)
+			}
+			So(tracer.spans[1].attributes["http.status_code"], ShouldEqual, http.StatusServiceUnavailable)
+			So(tracer.spans[3].attributes["bitpay.retry"], ShouldBeTrue)
+		})
+
+		Convey("Canceled contexts should stop the calls", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, _, err := bitpay.WithContext(ctx).GetInvoice("invoice-id")
+
+			So(err, ShouldNotBeNil)
+			So(tracer.spans[0].errors, ShouldHaveLength, 1)
+		})
+
+		Convey("Requests sent with a deadline should keep it", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			defer cancel()
+			<-ctx.Done()
+
+			req, err := bitpay.NewRequestWithAuth("GET", server.URL+"/invoices/invoice-id", nil)
+			So(err, ShouldBeNil)
+			_, err = bitpay.WithContext(context.Background()).Send(req.WithContext(ctx), nil)
+
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("Middleware added to a client with a context should not change the client", func() {
+			var calls []string
+			record := func(name string) Middleware {
+				return BeforeRequest(func(*http.Request) error {
+					calls = append(calls, name)
+					return nil
+				})
+			}
+			bitpay.Use(record("first"), record("second"))
+			bitpay.Use(record("third"))
+
+			clone := bitpay.WithContext(context.Background())
+			clone.Use(record("clone"))
+			bitpay.Use(record("client"))
+
+			_, _, err := clone.GetInvoice("invoice-id")
+			So(err, ShouldBeNil)
+			So(calls, ShouldResemble, []string{"first", "second", "third", "clone"})
+		})
+	})
+}
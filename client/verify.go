@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/conformal/btcec"
+	"github.com/fundary/bitauth"
+)
+
+var (
+	// ErrRequestNotSigned is returned when a request has no X-Identity or
+	// X-Signature header
+	ErrRequestNotSigned = errors.New("request is not signed, X-Identity or X-Signature header missing")
+
+	// ErrInvalidSignature is returned when the signature of a request doesn't
+	// match its identity and message
+	ErrInvalidSignature = errors.New("signature does not match the identity and message")
+
+	// ErrSessionRequestNotSigned is returned for requests of clients in
+	// session mode, which are only signed when sent. Verify the request
+	// received by the transport of the HTTP client instead.
+	ErrSessionRequestNotSigned = errors.New("request is signed when sent in session mode, verify the request received by the HTTP transport")
+)
+
+// Verification details how a request was signed
+type Verification struct {
+	// Message is the string signed by NewRequestWithAuth, the full URL
+	// followed by the body
+	Message string
+
+	// Hash is the hex encoded SHA-256 hash of Message, the signed hash
+	Hash string
+
+	// PublicKey is the X-Identity header, the hex encoded public key
+	PublicKey string
+
+	// SIN is the client ID derived from PublicKey
+	SIN string
+
+	// Signature is the X-Signature header, the hex encoded DER signature
+	Signature string
+
+	// Valid tells whether Signature signs Message for PublicKey
+	Valid bool
+}
+
+// VerifyRequest recomputes the message signed for a request, the URL
+// followed by the body as in NewRequestWithAuth, and checks the X-Signature
+// header against it and the X-Identity header. The body of the request is
+// left readable.
+//
+// The returned Verification holds what was signed, even when the signature
+// doesn't match. Requests received by a server are verified against the
+// URL built from their Host header.
+func VerifyRequest(req *http.Request) (*Verification, error) {
+	u := *req.URL
+	if !u.IsAbs() {
+		u.Scheme = "http"
+		if req.TLS != nil {
+			u.Scheme = "https"
+		}
+		u.Host = req.Host
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	v := &Verification{
+		Message:   u.String() + string(body),
+		PublicKey: req.Header.Get("X-Identity"),
+		Signature: req.Header.Get("X-Signature"),
+	}
+	hash := sha256.Sum256([]byte(v.Message))
+	v.Hash = hex.EncodeToString(hash[:])
+
+	if v.PublicKey == "" || v.Signature == "" {
+		if _, ok := req.Context().Value(authRequestKey{}).(*authRequest); ok {
+			return v, ErrSessionRequestNotSigned
+		}
+
+		return v, ErrRequestNotSigned
+	}
+
+	pub, err := hex.DecodeString(v.PublicKey)
+	if err != nil {
+		return v, fmt.Errorf("invalid X-Identity header: %s", err)
+	}
+	pubKey, err := btcec.ParsePubKey(pub, btcec.S256())
+	if err != nil {
+		return v, fmt.Errorf("invalid X-Identity header: %s", err)
+	}
+	sin, err := bitauth.GetSINFromPublicKeyString(v.PublicKey)
+	if err != nil {
+		return v, fmt.Errorf("invalid X-Identity header: %s", err)
+	}
+	v.SIN = string(sin)
+
+	sig, err := hex.DecodeString(v.Signature)
+	if err != nil {
+		return v, fmt.Errorf("invalid X-Signature header: %s", err)
+	}
+	signature, err := btcec.ParseSignature(sig, btcec.S256())
+	if err != nil {
+		return v, fmt.Errorf("invalid X-Signature header: %s", err)
+	}
+
+	if !signature.Verify(hash[:], pubKey) {
+		return v, ErrInvalidSignature
+	}
+	v.Valid = true
+
+	return v, nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	Convey("With requests signed by a client", t, func() {
+		bitpay := NewClientWithAuth(testPrivateKey, "token", "https://test.bitpay.com")
+		_, sin, err := DeriveIdentity(testPrivateKey)
+		So(err, ShouldBeNil)
+
+		Convey("Signed requests should be valid", func() {
+			req, err := bitpay.NewRequestWithAuth("POST", "https://test.bitpay.com/invoices", Invoice{Price: 1, Currency: "USD"})
+			So(err, ShouldBeNil)
+
+			v, err := VerifyRequest(req)
+
+			So(err, ShouldBeNil)
+			So(v.Valid, ShouldBeTrue)
+			So(v.SIN, ShouldEqual, sin)
+			So(v.Message, ShouldStartWith, `https://test.bitpay.com/invoices{`)
+			So(v.Message, ShouldContainSubstring, `"token":"token"`)
+
+			b, err := ioutil.ReadAll(req.Body)
+			So(err, ShouldBeNil)
+			So("https://test.bitpay.com/invoices"+string(b), ShouldEqual, v.Message)
+		})
+
+		Convey("Tampered requests should report what was signed", func() {
+			req, err := bitpay.NewRequestWithAuth("GET", "https://test.bitpay.com/invoices", nil)
+			So(err, ShouldBeNil)
+			req.URL.RawQuery += "&limit=1"
+
+			v, err := VerifyRequest(req)
+
+			So(err, ShouldEqual, ErrInvalidSignature)
+			So(v.Valid, ShouldBeFalse)
+			So(v.Message, ShouldEqual, "https://test.bitpay.com/invoices?token=token&limit=1")
+		})
+
+		Convey("Requests received by a server should be verified against their host", func() {
+			var valid bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				v, err := VerifyRequest(r)
+				valid = err == nil && v.Valid
+			}))
+			defer server.Close()
+
+			local := NewClientWithAuth(testPrivateKey, "token", server.URL)
+			req, err := local.NewRequestWithAuth("PUT", server.URL+"/user", map[string]interface{}{"phone": "555"})
+			So(err, ShouldBeNil)
+			_, err = http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+
+			So(valid, ShouldBeTrue)
+		})
+
+		Convey("Unsigned requests should be rejected", func() {
+			req, err := http.NewRequest("POST", "https://test.bitpay.com/invoices", strings.NewReader("{}"))
+			So(err, ShouldBeNil)
+
+			_, err = VerifyRequest(req)
+
+			So(err, ShouldEqual, ErrRequestNotSigned)
+		})
+	})
+}
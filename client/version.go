@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// APIVersionHeaders are the response headers the API version used by the
+// server is read from, in order
+var APIVersionHeaders = []string{"X-Api-Version", "X-BitPay-Api-Version"}
+
+// VersionDecoder is implemented by resources whose JSON differs between API
+// versions. Send decodes into a VersionDecoder, or a slice of them, with the
+// version reported by the server, or the requested one if none was. The
+// resources of this package only have the 2.0.0 shape so far, so none of them
+// implements it yet.
+type VersionDecoder interface {
+	DecodeVersion(version string, data []byte) error
+}
+
+// APIVersion returns the API version requested by the client
+func (c *Client) APIVersion() string {
+	return c.apiVersion
+}
+
+// ServerAPIVersion returns the API version reported by the last response of
+// the server, empty if none did
+func (c *Client) ServerAPIVersion() string {
+	v, _ := c.serverVersion.Load().(string)
+
+	return v
+}
+
+// ResponseAPIVersion returns the API version reported by a response, empty
+// if it doesn't have one of the APIVersionHeaders
+func ResponseAPIVersion(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+
+	for _, h := range APIVersionHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// CompareAPIVersions compares two dotted versions, e.g. 2.0.0 and 2.1, and
+// returns -1, 0 or 1. Missing components count as 0.
+func CompareAPIVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+var versionDecoderType = reflect.TypeOf((*VersionDecoder)(nil)).Elem()
+
+// decodeVersion decodes data into v, going through DecodeVersion when v, or
+// the elements of the slice v points to, are version decoders
+func decodeVersion(version string, data []byte, v interface{}) error {
+	if d, ok := v.(VersionDecoder); ok {
+		return d.DecodeVersion(version, data)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return json.Unmarshal(data, v)
+	}
+
+	elem := rv.Elem().Type().Elem()
+	if !reflect.PtrTo(elem).Implements(versionDecoderType) {
+		return json.Unmarshal(data, v)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(rv.Elem().Type(), len(raw), len(raw))
+	for i, r := range raw {
+		if err := slice.Index(i).Addr().Interface().(VersionDecoder).DecodeVersion(version, r); err != nil {
+			return err
+		}
+	}
+	rv.Elem().Set(slice)
+
+	return nil
+}
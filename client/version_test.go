@@ -0,0 +1,106 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPIVersion(t *testing.T) {
+	Convey("Comparing API versions", t, func() {
+		So(CompareAPIVersions("2.0.0", "2.1.0"), ShouldEqual, -1)
+		So(CompareAPIVersions("2.1", "2.1.0"), ShouldEqual, 0)
+		So(CompareAPIVersions("10.0.0", "2.1.0"), ShouldEqual, 1)
+		So(CompareAPIVersions("", "2.1.0"), ShouldEqual, -1)
+	})
+
+	Convey("With a server reporting its API version", t, func() {
+		var requested string
+		reported := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = r.Header.Get("X-Accept-Version")
+			if reported != "" {
+				w.Header().Set("X-Api-Version", reported)
+			}
+
+			// Each version of versionedRate reads a different field
+			w.Write([]byte(`{"data":[{"code":"USD","rate":1,"value":2}]}`))
+		}))
+		defer server.Close()
+
+		get := func(bitpay *Client) []versionedRate {
+			req, err := bitpay.NewRequestWithAuth("GET", server.URL+"/rates", nil)
+			So(err, ShouldBeNil)
+
+			var rates []versionedRate
+			_, err = bitpay.Send(req, &rates)
+			So(err, ShouldBeNil)
+			So(rates, ShouldHaveLength, 1)
+
+			return rates
+		}
+
+		Convey("The requested version should be sent and used to decode", func() {
+			bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"), WithAPIVersion("3.0.0"))
+			So(err, ShouldBeNil)
+
+			rates := get(bitpay)
+
+			So(bitpay.APIVersion(), ShouldEqual, "3.0.0")
+			So(requested, ShouldEqual, "3.0.0")
+			So(bitpay.ServerAPIVersion(), ShouldBeEmpty)
+			So(rates[0].Rate, ShouldEqual, 2)
+		})
+
+		Convey("The reported version should be surfaced and take precedence", func() {
+			reported = "2.0.0"
+			bitpay, err := New(WithBaseURL(server.URL), WithPrivateKey(testPrivateKey), WithToken("token"), WithAPIVersion("3.0.0"))
+			So(err, ShouldBeNil)
+
+			rates := get(bitpay)
+
+			So(bitpay.ServerAPIVersion(), ShouldEqual, "2.0.0")
+			So(rates[0].Code, ShouldEqual, "USD")
+			So(rates[0].Rate, ShouldEqual, 1)
+		})
+
+		Convey("Resources that aren't version decoders should decode as usual", func() {
+			bitpay := NewClientWithAuth(testPrivateKey, "token", server.URL)
+			req, err := bitpay.NewRequestWithAuth("GET", server.URL+"/rates", nil)
+			So(err, ShouldBeNil)
+
+			var rates []Rate
+			_, err = bitpay.Send(req, &rates)
+
+			So(err, ShouldBeNil)
+			So(rates[0].Code, ShouldEqual, "USD")
+		})
+	})
+}
+
+// versionedRate is a resource whose rate moved to the value field in 3.0.0
+type versionedRate struct {
+	Code string
+	Rate float64
+}
+
+func (r *versionedRate) DecodeVersion(version string, data []byte) error {
+	var v struct {
+		Code  string  `json:"code"`
+		Rate  float64 `json:"rate"`
+		Value float64 `json:"value"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	r.Code, r.Rate = v.Code, v.Rate
+	if CompareAPIVersions(version, "3.0.0") >= 0 {
+		r.Rate = v.Value
+	}
+
+	return nil
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"encoding/hex"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/fundary/bitauth"
 	"github.com/fundary/bitpay/client"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func PanicIf(err error) {
@@ -30,12 +36,45 @@ func main() {
 		},
 	}
 
+	keystoreFlag := cli.StringFlag{
+		Name:   "keystore",
+		Usage:  "Encrypted keystore holding the private key and tokens, its passphrase is read from BITPAY_KEYSTORE_PASSPHRASE or prompted for",
+		EnvVar: "BITPAY_KEYSTORE",
+	}
+
+	signerKeyFlag := cli.StringFlag{
+		Name:   "signer-key",
+		Usage:  "Key authenticating the clients of a signer, required to serve it on a TCP address",
+		EnvVar: "BITPAY_SIGNER_KEY",
+	}
+
+	authFlags := append([]cli.Flag{
+		keystoreFlag,
+		cli.StringFlag{
+			Name:   "key",
+			Usage:  "Hex encoded private key of the client ID",
+			EnvVar: "BITPAY_PRIVATE_KEY",
+		},
+		cli.StringFlag{
+			Name:   "signer",
+			Usage:  "Address of a signer served by the signer command (http://host:port or unix:/path), instead of a private key",
+			EnvVar: "BITPAY_SIGNER",
+		},
+		signerKeyFlag,
+		cli.StringFlag{
+			Name:   "token",
+			Usage:  "API token to authenticate with",
+			EnvVar: "BITPAY_TOKEN",
+		},
+	}, flags...)
+
 	app.Commands = []cli.Command{
 		{
 			Name:      "generate",
 			ShortName: "g",
-			Usage:     "Generate a new public/private key pair and a client id",
+			Usage:     "Generate a new public/private key pair and a client id, written to a new keystore if one is given",
 			Action:    GenerateKeysAndSIN,
+			Flags:     []cli.Flag{keystoreFlag},
 		},
 		{
 			Name:      "new-token",
@@ -51,13 +90,250 @@ func main() {
 			Action:    ClaimToken,
 			Flags:     flags,
 		},
+		{
+			Name:   "pair",
+			Usage:  "Request a token, wait until it is approved in the dashboard and save it to the keystore or credentials file, requires 2 arguments (label, facade)",
+			Action: Pair,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:   "keystore",
+					Value:  "bitpay.keystore",
+					Usage:  keystoreFlag.Usage + ", created if it doesn't exist",
+					EnvVar: keystoreFlag.EnvVar,
+				},
+				cli.StringFlag{
+					Name:  "key",
+					Usage: "Hex encoded private key of the client ID, defaults to the one of the keystore or credentials file or a new one",
+				},
+				cli.StringFlag{
+					Name:  "credentials",
+					Usage: "Plain JSON file the private key and tokens are saved to instead of the keystore, unencrypted",
+				},
+				cli.DurationFlag{
+					Name:  "interval",
+					Value: client.DefaultPairingPollInterval,
+					Usage: "How often to check whether the token was approved",
+				},
+			}, flags...),
+		},
+		{
+			Name:   "list-clients",
+			Usage:  "List the client IDs paired with the merchant account along with their tokens",
+			Action: ListClients,
+			Flags:  authFlags,
+		},
+		{
+			Name:   "revoke-client",
+			Usage:  "Revoke a client ID and all of its tokens, requires 1 argument (clientID)",
+			Action: RevokeClient,
+			Flags:  authFlags,
+		},
+		{
+			Name:   "export-ledger",
+			Usage:  "Export the ledger entries of a currency to CSV, OFX, QIF or a double-entry journal, requires 1 argument (currency)",
+			Action: ExportLedger,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Value: "csv",
+					Usage: "Export format: csv, ofx, qif or journal",
+				},
+				cli.StringFlag{
+					Name:  "start",
+					Usage: "First day of the export (YYYY-MM-DD), defaults to 30 days ago",
+				},
+				cli.StringFlag{
+					Name:  "end",
+					Usage: "Last day of the export (YYYY-MM-DD), defaults to today",
+				},
+				cli.StringFlag{
+					Name:  "accounts",
+					Usage: "JSON file mapping entry categories and codes to chart-of-accounts codes, used by the journal format",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Usage: "File to write the export to, defaults to stdout",
+				},
+			}, authFlags...),
+		},
+		{
+			Name:  "key",
+			Usage: "Convert private keys between hex, SEC1 PEM, PKCS#8 PEM and keystores",
+			Subcommands: []cli.Command{
+				{
+					Name:   "export",
+					Usage:  "Export the private key of a keystore or of the key flag",
+					Action: ExportKey,
+					Flags: []cli.Flag{
+						keystoreFlag,
+						cli.StringFlag{
+							Name:   "key",
+							Usage:  "Hex encoded private key to export",
+							EnvVar: "BITPAY_PRIVATE_KEY",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Value: "sec1",
+							Usage: "Export format: hex, sec1, pkcs8 or keystore, only keystores are encrypted",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "File to write the key to, defaults to stdout, required by the keystore format",
+						},
+					},
+				},
+				{
+					Name:   "import",
+					Usage:  "Import a hex, PEM or keystore private key file and print its client ID, requires 1 argument (file)",
+					Action: ImportKey,
+					Flags:  []cli.Flag{keystoreFlag},
+				},
+			},
+		},
+		{
+			Name:   "debug-sign",
+			Usage:  "Print the message, hash, signature and client ID of a signed call, requires 2 arguments (method, endpoint) and an optional JSON body. With the signature flag, check a captured signature against the exact URL and body instead",
+			Action: DebugSign,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "identity",
+					Usage: "X-Identity header of the captured call",
+				},
+				cli.StringFlag{
+					Name:  "signature",
+					Usage: "X-Signature header of the captured call",
+				},
+			}, authFlags...),
+		},
+		{
+			Name:   "proxy",
+			Usage:  "Sign and forward the API calls of other services, allowed by the callers file, so they never hold the private key or tokens",
+			Action: Proxy,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "listen",
+					Value: "127.0.0.1:8091",
+					Usage: "Local address to listen on",
+				},
+				cli.StringFlag{
+					Name:  "callers",
+					Value: "proxy.json",
+					Usage: "JSON file listing the callers, their keys and the calls they are allowed to make",
+				},
+			}, authFlags...),
+		},
+		{
+			Name:   "signer",
+			Usage:  "Serve the private key of a keystore or of the key flag to other processes, which only ever get signatures",
+			Action: ServeSigner,
+			Flags: []cli.Flag{
+				keystoreFlag,
+				cli.StringFlag{
+					Name:   "key",
+					Usage:  "Hex encoded private key of the client ID",
+					EnvVar: "BITPAY_PRIVATE_KEY",
+				},
+				cli.StringFlag{
+					Name:  "listen",
+					Value: "unix:bitpay-signer.sock",
+					Usage: "Address to listen on, a Unix socket (unix:/path) or a local TCP address (127.0.0.1:port)",
+				},
+				signerKeyFlag,
+			},
+		},
 	}
 
 	err := app.Run(os.Args)
 	PanicIf(err)
 }
 
+// APIBase returns the API base URL of the environment selected by the env flag
+func APIBase(c *cli.Context) string {
+	if c.String("env") == "prod" {
+		return client.APIBaseProd
+	}
+
+	return client.APIBaseTest
+}
+
+// AuthClient returns a client authenticated with the keystore flag, or the key
+// and token flags
+func AuthClient(c *cli.Context) *client.Client {
+	if c.String("keystore") != "" {
+		keystore, err := client.OpenKeystore(c.String("keystore"), Passphrase(false))
+		PanicIf(err)
+
+		return client.NewClientFromKeystore(keystore, APIBase(c))
+	}
+
+	if c.String("signer") != "" {
+		if c.String("token") == "" {
+			log.Fatal("A token is required along with the signer, see usage")
+		}
+
+		signer, err := client.NewRemoteSigner(c.String("signer"), c.String("signer-key"))
+		PanicIf(err)
+
+		return client.NewClientWithSigner(signer, c.String("token"), APIBase(c))
+	}
+
+	if c.String("key") == "" || c.String("token") == "" {
+		log.Fatal("A keystore, a signer, or a private key and a token are required, see usage")
+	}
+
+	bitpay, err := client.New(
+		client.WithBaseURL(APIBase(c)),
+		client.WithPrivateKey(c.String("key")),
+		client.WithToken(c.String("token")),
+	)
+	PanicIf(err)
+
+	return bitpay
+}
+
+// Passphrase returns the keystore passphrase from BITPAY_KEYSTORE_PASSPHRASE,
+// or prompts for it, twice when confirm is set
+func Passphrase(confirm bool) []byte {
+	return PromptPassphrase("Keystore passphrase", "BITPAY_KEYSTORE_PASSPHRASE", confirm)
+}
+
+// PromptPassphrase returns the passphrase from the env environment variable,
+// or prompts for it
+func PromptPassphrase(prompt, env string, confirm bool) []byte {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return []byte(passphrase)
+	}
+
+	os.Stderr.WriteString(prompt + ": ")
+	passphrase, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	os.Stderr.WriteString("\n")
+	PanicIf(err)
+
+	if confirm {
+		os.Stderr.WriteString("Repeat passphrase: ")
+		repeated, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		os.Stderr.WriteString("\n")
+		PanicIf(err)
+
+		if string(repeated) != string(passphrase) {
+			log.Fatal("Passphrases don't match")
+		}
+	}
+
+	return passphrase
+}
+
 func GenerateKeysAndSIN(c *cli.Context) {
+	if c.String("keystore") != "" {
+		keystore, err := client.CreateKeystore(c.String("keystore"), Passphrase(true), "")
+		PanicIf(err)
+		println("Public key: " + keystore.PublicKey)
+		println("Client ID: ", keystore.SIN)
+		println("Private key saved to: " + keystore.Path())
+
+		return
+	}
+
 	sin, err := bitauth.GenerateSIN()
 	PanicIf(err)
 	println("Public key: " + hex.EncodeToString(sin.PublicKey))
@@ -72,14 +348,7 @@ func NewToken(c *cli.Context) {
 		return
 	}
 
-	var url string
-	if c.String("env") == "prod" {
-		url = client.APIBaseProd
-	} else {
-		url = client.APIBaseTest
-	}
-
-	bitpay := client.NewClient(url)
+	bitpay := client.NewClient(APIBase(c))
 
 	tokenResp, err := bitpay.NewToken(c.Args()[0], c.Args()[1], client.Facade(c.Args()[2]))
 	PanicIf(err)
@@ -97,20 +366,297 @@ func ClaimToken(c *cli.Context) {
 		return
 	}
 
-	var url string
-	if c.String("env") == "prod" {
-		url = client.APIBaseProd
+	bitpay := client.NewClient(APIBase(c))
+
+	tokenResp, err := bitpay.ClaimToken(c.Args()[0], c.Args()[1], c.Args()[2])
+	PanicIf(err)
+
+	json, err := json.MarshalIndent(&tokenResp, "", "	")
+	PanicIf(err)
+
+	println(string(json))
+}
+
+func Pair(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		println("Requires 2 arguments, see usage")
+
+		return
+	}
+
+	var bitpay *client.Client
+	var store client.TokenStore
+	var saved string
+	if path := c.String("keystore"); c.String("credentials") == "" {
+		var keystore *client.Keystore
+		var err error
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			keystore, err = client.CreateKeystore(path, Passphrase(true), c.String("key"))
+		} else {
+			keystore, err = client.OpenKeystore(path, Passphrase(false))
+		}
+		PanicIf(err)
+
+		bitpay = client.NewClientFromKeystore(keystore, APIBase(c))
+		store = keystore
+		saved = path
 	} else {
-		url = client.APIBaseTest
+		creds, err := client.LoadCredentials(c.String("credentials"))
+		PanicIf(err)
+
+		if c.String("key") != "" {
+			creds.PrivateKey = c.String("key")
+		}
+		if creds.PrivateKey == "" {
+			sin, err := bitauth.GenerateSIN()
+			PanicIf(err)
+			creds.PrivateKey = hex.EncodeToString(sin.PrivateKey)
+		}
+
+		bitpay = client.NewClientWithAuth(creds.PrivateKey, "", APIBase(c))
+		creds.SIN = bitpay.ClientID()
+		PanicIf(creds.Save())
+		store = creds
+		saved = c.String("credentials")
 	}
 
-	bitpay := client.NewClient(url)
+	token, err := bitpay.Pair(c.Args()[0], client.Facade(c.Args()[1]), client.PairingOptions{
+		PollInterval: c.Duration("interval"),
+		Store:        store,
+		Pending: func(p *client.Pairing) {
+			println("Client ID: " + bitpay.ClientID())
+			println("Pairing code: " + p.Token.PairingCode)
+			println("Approve the pairing at: " + p.ApprovalURL)
+			println("Waiting for approval...")
+		},
+	})
+	PanicIf(err)
 
-	tokenResp, err := bitpay.ClaimToken(c.Args()[0], c.Args()[1], c.Args()[2])
+	println("Approved " + string(token.FacadeName()) + " token, saved to " + saved)
+}
+
+func ListClients(c *cli.Context) {
+	bitpay := AuthClient(c)
+
+	clients, _, err := bitpay.QueryClients()
 	PanicIf(err)
 
-	json, err := json.MarshalIndent(&tokenResp, "", "	")
+	json, err := json.MarshalIndent(&clients, "", "	")
 	PanicIf(err)
 
 	println(string(json))
 }
+
+func RevokeClient(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		println("Requires 1 argument, see usage")
+
+		return
+	}
+
+	bitpay := AuthClient(c)
+
+	_, err := bitpay.DeleteClient(c.Args()[0])
+	PanicIf(err)
+
+	println("Revoked client ID: " + c.Args()[0])
+}
+
+func ExportLedger(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		println("Requires 1 argument, see usage")
+
+		return
+	}
+
+	end := time.Now()
+	if c.String("end") != "" {
+		var err error
+		end, err = time.Parse("2006-01-02", c.String("end"))
+		PanicIf(err)
+	}
+
+	start := end.AddDate(0, 0, -30)
+	if c.String("start") != "" {
+		var err error
+		start, err = time.Parse("2006-01-02", c.String("start"))
+		PanicIf(err)
+	}
+
+	accounts := client.DefaultChartOfAccounts
+	if c.String("accounts") != "" {
+		f, err := os.Open(c.String("accounts"))
+		PanicIf(err)
+		err = json.NewDecoder(f).Decode(&accounts)
+		f.Close()
+		PanicIf(err)
+	}
+
+	exporter, err := client.NewLedgerExporter(c.String("format"), accounts)
+	PanicIf(err)
+
+	bitpay := AuthClient(c)
+	currency := c.Args()[0]
+
+	entries, _, err := bitpay.GetLedger(currency, start, end)
+	PanicIf(err)
+
+	var w io.Writer = os.Stdout
+	if c.String("output") != "" {
+		f, err := os.Create(c.String("output"))
+		PanicIf(err)
+		defer f.Close()
+		w = f
+	}
+
+	err = exporter.ExportLedger(w, currency, entries)
+	PanicIf(err)
+}
+
+func DebugSign(c *cli.Context) {
+	if len(c.Args()) < 2 {
+		println("Requires 2 arguments, see usage")
+
+		return
+	}
+
+	method := strings.ToUpper(c.Args()[0])
+	endpoint := c.Args()[1]
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = APIBase(c) + endpoint
+	}
+	var body string
+	if len(c.Args()) > 2 {
+		body = c.Args()[2]
+	}
+
+	var req *http.Request
+	var err error
+	if c.String("signature") != "" {
+		req, err = http.NewRequest(method, endpoint, strings.NewReader(body))
+		PanicIf(err)
+		req.Header.Set("X-Identity", c.String("identity"))
+		req.Header.Set("X-Signature", c.String("signature"))
+	} else {
+		var payload interface{}
+		if body != "" {
+			PanicIf(json.Unmarshal([]byte(body), &payload))
+		}
+		req, err = AuthClient(c).NewRequestWithAuth(method, endpoint, payload)
+		PanicIf(err)
+	}
+
+	v, err := client.VerifyRequest(req)
+	println("Message:     " + v.Message)
+	println("SHA-256:     " + v.Hash)
+	println("X-Identity:  " + v.PublicKey)
+	println("X-Signature: " + v.Signature)
+	println("Client ID:   " + v.SIN)
+	if err != nil {
+		println("Invalid: " + err.Error())
+		os.Exit(1)
+	}
+	println("Valid signature")
+}
+
+func Proxy(c *cli.Context) {
+	config, err := client.LoadProxyConfig(c.String("callers"))
+	PanicIf(err)
+
+	bitpay := AuthClient(c)
+
+	log.Printf("Proxying %d callers to %s on %s", len(config.Callers), APIBase(c), c.String("listen"))
+	PanicIf(http.ListenAndServe(c.String("listen"), client.NewProxy(bitpay, config.Callers)))
+}
+
+func ServeSigner(c *cli.Context) {
+	var signer client.Signer
+	switch {
+	case c.String("keystore") != "":
+		keystore, err := client.OpenKeystore(c.String("keystore"), Passphrase(false))
+		PanicIf(err)
+		signer = keystore.Signer()
+	case c.String("key") != "":
+		s, err := client.NewKeySigner(c.String("key"))
+		PanicIf(err)
+		signer = s
+	default:
+		log.Fatal("A keystore or a private key is required, see usage")
+	}
+
+	log.Printf("Signing for client ID %s on %s", signer.SIN(), c.String("listen"))
+	PanicIf(client.ServeSigner(c.String("listen"), signer, c.String("signer-key")))
+}
+
+func ExportKey(c *cli.Context) {
+	var privateKey string
+	switch {
+	case c.String("keystore") != "":
+		keystore, err := client.OpenKeystore(c.String("keystore"), Passphrase(false))
+		PanicIf(err)
+		privateKey = keystore.PrivateKey
+	case c.String("key") != "":
+		privateKey = c.String("key")
+	default:
+		log.Fatal("A keystore or a private key is required, see usage")
+	}
+
+	if c.String("format") == "keystore" {
+		if c.String("output") == "" {
+			log.Fatal("The keystore format requires an output file, see usage")
+		}
+
+		keystore, err := client.CreateKeystore(c.String("output"), Passphrase(true), privateKey)
+		PanicIf(err)
+		println("Client ID: ", keystore.SIN)
+		println("Private key saved to: " + keystore.Path())
+
+		return
+	}
+
+	b, err := client.EncodePrivateKey(privateKey, client.KeyFormat(c.String("format")))
+	PanicIf(err)
+
+	if c.String("output") == "" {
+		os.Stdout.Write(b)
+
+		return
+	}
+
+	PanicIf(ioutil.WriteFile(c.String("output"), b, 0600))
+	_, sin, err := client.DeriveIdentity(privateKey)
+	PanicIf(err)
+	println("Client ID: ", sin)
+	println("Private key saved to: " + c.String("output"))
+}
+
+func ImportKey(c *cli.Context) {
+	if len(c.Args()) < 1 {
+		println("Requires 1 argument, see usage")
+
+		return
+	}
+
+	privateKey, err := client.ReadPrivateKey(c.Args()[0], nil)
+	if err == client.ErrKeyPassphraseRequired {
+		privateKey, err = client.ReadPrivateKey(c.Args()[0], PromptPassphrase("Key passphrase", "BITPAY_KEY_PASSPHRASE", false))
+	}
+	PanicIf(err)
+
+	publicKey, sin, err := client.DeriveIdentity(privateKey)
+	PanicIf(err)
+
+	if c.String("keystore") != "" {
+		keystore, err := client.CreateKeystore(c.String("keystore"), Passphrase(true), privateKey)
+		PanicIf(err)
+		println("Public key: " + publicKey)
+		println("Client ID: ", sin)
+		println("Private key saved to: " + keystore.Path())
+
+		return
+	}
+
+	println("Public key: " + publicKey)
+	println("Private key: " + privateKey)
+	println("Client ID: ", sin)
+}